@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mxssl/doh/query"
+	"github.com/spf13/cobra"
+)
+
+var (
+	batchInput     string
+	batchWorkers   int
+	batchUnordered bool
+	batchFormat    string
+)
+
+func init() {
+	batchCmd.Flags().StringVarP(&batchInput, "input", "i", "-", "file with one \"type name\" or JSON query per line, - for stdin")
+	batchCmd.Flags().IntVarP(&batchWorkers, "workers", "w", 8, "maximum number of concurrent queries")
+	batchCmd.Flags().BoolVar(&batchUnordered, "unordered", false, "print results as they complete instead of in input order")
+	batchCmd.Flags().StringVarP(&batchFormat, "format", "f", query.BatchFormatText, "output format (text, jsonl, csv)")
+	rootCmd.AddCommand(batchCmd)
+}
+
+var batchCmd = &cobra.Command{
+	Use:          "batch [flags]",
+	Short:        "Resolve many names from a file or stdin concurrently",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		var in io.Reader = cmd.InOrStdin()
+		if batchInput != "-" {
+			f, err := os.Open(batchInput)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = f.Close()
+			}()
+			in = f
+		}
+
+		writer, err := query.NewBatchWriter(cmd.OutOrStdout(), batchFormat)
+		if err != nil {
+			return err
+		}
+		total, failed := 0, 0
+		err = client.BatchFrom(context.Background(), query.NewBatchReader(in), batchWorkers, !batchUnordered, func(res query.BatchResult) error {
+			total++
+			var rcodeErr query.RcodeError
+			if res.Err != nil && !errors.As(res.Err, &rcodeErr) {
+				failed++
+			}
+			return writer.Write(res)
+		})
+		if flushErr := writer.Flush(); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d queries failed", failed, total)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/mxssl/doh/query"
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchProviders   []string
+	benchNames       []string
+	benchTypes       []string
+	benchCount       int
+	benchConcurrency int
+	benchCold        bool
+	benchJSON        bool
+)
+
+func init() {
+	benchCmd.Flags().StringSliceVar(&benchProviders, "providers", nil, "comma separated providers or endpoint URLs to benchmark (default all known providers)")
+	benchCmd.Flags().StringSliceVar(&benchNames, "names", []string{"example.com"}, "comma separated names to query")
+	benchCmd.Flags().StringSliceVar(&benchTypes, "types", []string{"A"}, "comma separated record types to query")
+	benchCmd.Flags().IntVarP(&benchCount, "count", "n", 100, "number of queries sent to each provider")
+	benchCmd.Flags().IntVarP(&benchConcurrency, "concurrency", "c", 1, "number of concurrent queries")
+	benchCmd.Flags().BoolVar(&benchCold, "cold", false, "open a new connection for every query instead of reusing warm connections")
+	benchCmd.Flags().BoolVar(&benchJSON, "json", false, "output the results in JSON format")
+	rootCmd.AddCommand(benchCmd)
+}
+
+var benchCmd = &cobra.Command{
+	Use:          "bench [flags]",
+	Short:        "Measure the query latency of providers",
+	Long:         "Bench sends --count queries to every provider, one provider after another, and reports the min, median, p95 and p99 latency, the error rate and the rcode distribution.",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := benchProviders
+		if len(names) == 0 {
+			names = query.ValidProviders()
+		}
+		opts, err := providerOptions(cmd.Name(), names)
+		if err != nil {
+			return err
+		}
+		b := &query.Benchmark{
+			Providers:   names,
+			Names:       benchNames,
+			Types:       benchTypes,
+			Count:       benchCount,
+			Concurrency: benchConcurrency,
+			Cold:        benchCold,
+			Options:     opts,
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		results, err := b.Run(ctx)
+		if len(results) == 0 {
+			return err
+		}
+		format := query.FormatText
+		if benchJSON {
+			format = query.FormatJSON
+		}
+		if outputErr := query.OutputBenchmark(results, format); outputErr != nil {
+			return outputErr
+		}
+		return err
+	},
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mxssl/doh/query"
+	"github.com/spf13/cobra"
+)
+
+var (
+	compareProviders []string
+	compareJSON      bool
+)
+
+func init() {
+	compareCmd.Flags().StringSliceVar(&compareProviders, "providers", nil, "comma separated providers or endpoint URLs to compare (default all known providers)")
+	compareCmd.Flags().BoolVar(&compareJSON, "json", false, "output the comparison in JSON format")
+	rootCmd.AddCommand(compareCmd)
+}
+
+var compareCmd = &cobra.Command{
+	Use:          "compare [query type] [domain name]",
+	Short:        "Compare the answers of several providers",
+	Long:         "Compare resolves the query through every provider concurrently, normalizes the answers (ignoring TTLs, trailing dots and RRSIG records) and exits with an error when the providers disagree.",
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := compareProviders
+		if len(names) == 0 {
+			names = query.ValidProviders()
+		}
+		opts, err := providerOptions(cmd.Name(), names)
+		if err != nil {
+			return err
+		}
+
+		cmp, err := query.Compare(context.Background(), names, args[1], args[0], opts...)
+		if err != nil {
+			return err
+		}
+		format := query.FormatText
+		if compareJSON {
+			format = query.FormatJSON
+		}
+		if err := query.OutputComparison(cmp, format); err != nil {
+			return err
+		}
+		if !cmp.Agree {
+			return errors.New("providers disagree")
+		}
+		return nil
+	},
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/mxssl/doh/query"
+	"github.com/spf13/cobra"
+)
+
+var (
+	propagateExpect      []string
+	propagateProviders   []string
+	propagateInterval    time.Duration
+	propagateMaxInterval time.Duration
+	propagateDeadline    time.Duration
+	propagateJSON        bool
+)
+
+func init() {
+	propagateCmd.Flags().StringArrayVar(&propagateExpect, "expect", nil, "record data every provider has to return, e.g. 192.0.2.1 or \"v=spf1 -all\" for TXT (repeatable)")
+	propagateCmd.Flags().StringSliceVar(&propagateProviders, "providers", nil, "comma separated providers or endpoint URLs to poll (default all known providers)")
+	propagateCmd.Flags().DurationVar(&propagateInterval, "interval", query.DefaultPropagateInterval, "delay before a provider is queried again, doubled after every miss")
+	propagateCmd.Flags().DurationVar(&propagateMaxInterval, "max-interval", query.DefaultPropagateMaxInterval, "upper bound of the delay between queries to a provider")
+	propagateCmd.Flags().DurationVar(&propagateDeadline, "deadline", 10*time.Minute, "give up when the records have not propagated after this long")
+	propagateCmd.Flags().BoolVar(&propagateJSON, "json", false, "output the final state in JSON format")
+	_ = propagateCmd.MarkFlagRequired("expect")
+	rootCmd.AddCommand(propagateCmd)
+}
+
+var propagateCmd = &cobra.Command{
+	Use:          "propagate [query type] [domain name]",
+	Short:        "Wait until all providers return the expected records",
+	Long:         "Propagate polls every provider with exponential backoff until each of them returns all the --expect values, showing a live status table, and exits with an error if the deadline expires first.",
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names := propagateProviders
+		if len(names) == 0 {
+			names = query.ValidProviders()
+		}
+		opts, err := providerOptions(cmd.Name(), names)
+		if err != nil {
+			return err
+		}
+		p := &query.Propagation{
+			Providers:   names,
+			Name:        args[1],
+			Type:        args[0],
+			Expect:      propagateExpect,
+			Interval:    propagateInterval,
+			MaxInterval: propagateMaxInterval,
+			Options:     opts,
+		}
+
+		out := cmd.OutOrStdout()
+		live := !propagateJSON && isTerminal(out)
+		if live {
+			lines := 0
+			p.Update = func(checks []query.PropagationCheck) {
+				if lines > 0 {
+					_, _ = fmt.Fprintf(out, "\x1b[%dA\x1b[J", lines)
+				}
+				table := query.FormatPropagation(checks)
+				lines = strings.Count(table, "\n")
+				_, _ = fmt.Fprint(out, table)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), propagateDeadline)
+		defer cancel()
+		checks, err := p.Run(ctx)
+		if checks == nil {
+			return err
+		}
+		if !live {
+			format := query.FormatText
+			if propagateJSON {
+				format = query.FormatJSON
+			}
+			if outputErr := query.OutputPropagation(checks, format); outputErr != nil {
+				return outputErr
+			}
+		}
+		return err
+	},
+}
+
+// isTerminal reports whether w is an interactive terminal that can be
+// redrawn in place.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isatty.IsTerminal(f.Fd())
+}
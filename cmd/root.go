@@ -3,7 +3,11 @@ package cmd
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/mxssl/doh/query"
 	"github.com/spf13/cobra"
@@ -12,7 +16,25 @@ import (
 var (
 	whoisFlag    bool
 	jsonFlag     bool
+	formatFlag   string
+	shortFlag    bool
+	templateFlag string
 	providerFlag string
+	providerURL  string
+	odohProxy    string
+	ecsFlag      string
+	dnssecFlag   bool
+	cdFlag       bool
+	configFlag   string
+	reverseFlag  string
+	fcrdnsFlag   bool
+	traceFlag    bool
+	traceNSFlag  bool
+	verboseFlag  bool
+	retriesFlag  int
+	backoffFlag  time.Duration
+	failoverFlag []string
+	raceFlag     []string
 	appVersion   string
 	appCommit    string
 )
@@ -21,17 +43,38 @@ var (
 var rootCmd = &cobra.Command{
 	Use:   "doh",
 	Short: "Simple DNS over HTTPS cli client",
-	Args:  cobra.MinimumNArgs(2),
+	Args: func(cmd *cobra.Command, args []string) error {
+		if reverseFlag != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return loadConfig(cmd.Flags().Changed("config"))
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		err := query.Do(args[0], args[1], whoisFlag, jsonFlag, providerFlag)
-		if err != nil && jsonFlag {
+		format, formatter, err := outputFormat()
+		if err != nil {
+			return err
+		}
+		opts, err := clientOptions([]string{primaryProvider()})
+		if err == nil {
+			if reverseFlag != "" {
+				err = query.DoReverseFormatter(reverseFlag, whoisFlag, formatter, fcrdnsFlag, providerFlag, opts...)
+			} else {
+				err = query.DoFormatter(args[0], args[1], whoisFlag, formatter, providerFlag, opts...)
+			}
+		}
+		if err != nil && format == query.FormatJSON {
 			query.OutputJSONError(err)
 			return nil // Prevent Cobra from printing error again
 		}
 		var rcodeErr query.RcodeError
 		if errors.As(err, &rcodeErr) {
-			if outputErr := query.OutputTextResponse(rcodeErr.Response); outputErr != nil {
-				return outputErr
+			if format != query.FormatShort {
+				if outputErr := formatter([]query.QueryOutput{{JSONOutput: rcodeErr.Response}}); outputErr != nil {
+					return outputErr
+				}
 			}
 			if _, printErr := fmt.Fprintf(cmd.ErrOrStderr(), "Error: %s\n", rcodeErr.Error()); printErr != nil {
 				return printErr
@@ -43,17 +86,210 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Flags().BoolVar(&whoisFlag, "whois", false, "perform WHOIS lookup for IP addresses")
+	rootCmd.PersistentFlags().BoolVar(&whoisFlag, "whois", false, "perform WHOIS lookup for IP addresses")
 	rootCmd.Flags().BoolVar(&jsonFlag, "json", false, "output results in JSON format")
-	rootCmd.Flags().StringVar(&providerFlag, "provider", query.DefaultProvider, "DNS-over-HTTPS provider (cloudflare, google)")
+	rootCmd.Flags().StringVarP(&formatFlag, "output", "o", query.FormatText, "output format ("+strings.Join(query.Formats(), ", ")+")")
+	rootCmd.Flags().StringVar(&formatFlag, "format", query.FormatText, "alias for --output")
+	rootCmd.Flags().BoolVar(&shortFlag, "short", false, "print only the data of answer records, one per line")
+	rootCmd.Flags().StringVar(&templateFlag, "template", "", "format each response with a Go text/template, e.g. '{{range .Records}}{{.Data}}{{\"\\n\"}}{{end}}'")
+	rootCmd.MarkFlagsMutuallyExclusive("json", "output", "format", "short", "template")
+	rootCmd.PersistentFlags().StringVar(&providerFlag, "provider", query.DefaultProvider, "provider to query: built-in name, config file name, or endpoint URL")
+	rootCmd.PersistentFlags().StringVar(&providerURL, "provider-url", "", "endpoint URL to query instead of --provider: https:// (RFC 8484), h3:// (RFC 8484 over HTTP/3), tls:// (DNS over TLS), quic:// (DNS over QUIC), odoh:// (Oblivious DoH target), udp:// or tcp:// (plain DNS)")
+	rootCmd.PersistentFlags().StringVar(&odohProxy, "odoh-proxy", "", "Oblivious DoH proxy URL used to relay queries to odoh targets, including --failover and --race ones")
+	rootCmd.PersistentFlags().StringVar(&ecsFlag, "ecs", "", "send an EDNS Client Subnet, e.g. 203.0.113.0/24, to get answers for that network")
+	rootCmd.PersistentFlags().BoolVar(&dnssecFlag, "dnssec", false, "request DNSSEC records (set the DO bit) and show RRSIG, NSEC and NSEC3 records")
+	rootCmd.PersistentFlags().BoolVar(&cdFlag, "cd", false, "set the checking disabled (CD) bit so the resolver skips DNSSEC validation")
+	rootCmd.Flags().StringVarP(&reverseFlag, "reverse", "x", "", "reverse lookup: query the PTR record for an IPv4 or IPv6 address")
+	rootCmd.Flags().BoolVar(&fcrdnsFlag, "fcrdns", false, "with -x, resolve the returned hostnames and confirm they point back to the address")
+	rootCmd.Flags().BoolVar(&traceFlag, "trace", false, "show the CNAME/DNAME chain of the answer as a tree")
+	rootCmd.Flags().BoolVar(&traceNSFlag, "trace-ns", false, "like --trace, and also query NS records to show the delegation path from the TLD to the zone")
+	rootCmd.PersistentFlags().BoolVarP(&verboseFlag, "verbose", "v", false, "report the request timing, HTTP protocol, TLS version and response headers (on stderr, or in the output of json, ndjson and yaml)")
+	rootCmd.PersistentFlags().IntVar(&retriesFlag, "retries", 0, "retry a query up to this many times on timeouts, HTTP 429 and 5xx errors")
+	rootCmd.PersistentFlags().DurationVar(&backoffFlag, "retry-backoff", query.DefaultRetryBackoff, "delay before the first retry, doubled for every further retry")
+	rootCmd.PersistentFlags().StringSliceVar(&failoverFlag, "failover", nil, "comma separated providers or endpoint URLs tried in order when the provider fails")
+	rootCmd.PersistentFlags().StringSliceVar(&raceFlag, "race", nil, "comma separated providers or endpoint URLs queried at the same time as the provider; the first answer wins")
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "config file with provider definitions (default ~/.config/doh/config.yaml)")
 }
 
+// loadConfig registers the providers from the config file. A missing file at
+// the default location is not an error.
+func loadConfig(explicit bool) error {
+	path := configFlag
+	if !explicit {
+		defaultPath, err := query.DefaultConfigPath()
+		if err != nil {
+			return nil
+		}
+		path = defaultPath
+	}
+	err := query.LoadConfig(path)
+	if err != nil && !explicit && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// outputFormat returns the name and formatter of the output format selected
+// by --output, --json, --short or --template.
+func outputFormat() (string, query.Formatter, error) {
+	format := formatFlag
+	switch {
+	case jsonFlag:
+		format = query.FormatJSON
+	case shortFlag:
+		format = query.FormatShort
+	case templateFlag != "":
+		f, err := query.NewTemplateFormatter(templateFlag)
+		if err != nil {
+			return "", nil, err
+		}
+		return query.FormatTemplate, f, nil
+	}
+	f, err := query.GetFormatter(format)
+	if err != nil {
+		return "", nil, err
+	}
+	return format, f, nil
+}
+
+// clientOptions converts the command line flags into query client options
+// for a command that queries providers, given by name or URL.
+func clientOptions(providers []string) ([]query.Option, error) {
+	var opts []query.Option
+	if providerURL != "" {
+		p, err := query.ParseProviderURL(providerURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --provider-url: %w", err)
+		}
+		opts = append(opts, query.WithProvider(p))
+	}
+	if odohProxy != "" {
+		if !anyODoH(slices.Concat(providers, failoverFlag, raceFlag)) {
+			return nil, errors.New("--odoh-proxy needs an odoh provider")
+		}
+		opts = append(opts, query.WithODoHProxy(odohProxy))
+	}
+	if ecsFlag != "" {
+		prefix, err := query.ParseClientSubnet(ecsFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --ecs: %w", err)
+		}
+		opts = append(opts, query.WithClientSubnet(prefix))
+	}
+	if dnssecFlag {
+		opts = append(opts, query.WithDNSSEC(true))
+	}
+	if cdFlag {
+		opts = append(opts, query.WithCheckingDisabled(true))
+	}
+	if traceFlag {
+		opts = append(opts, query.WithTrace(true))
+	}
+	if traceNSFlag {
+		opts = append(opts, query.WithTraceDelegation(true))
+	}
+	if verboseFlag {
+		opts = append(opts, query.WithVerbose(true))
+	}
+	if retriesFlag > 0 {
+		opts = append(opts, query.WithRetries(retriesFlag, backoffFlag))
+	}
+	if len(failoverFlag) > 0 {
+		failover, err := lookupProviders("--failover", failoverFlag)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, query.WithFailover(failover...))
+	}
+	if len(raceFlag) > 0 {
+		race, err := lookupProviders("--race", raceFlag)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, query.WithRace(race...))
+	}
+	return opts, nil
+}
+
+// providerOptions returns the client options of a command that queries
+// every one of providers on its own and so can neither fail over nor race.
+func providerOptions(command string, providers []string) ([]query.Option, error) {
+	flag := ""
+	switch {
+	case len(failoverFlag) > 0:
+		flag = "--failover"
+	case len(raceFlag) > 0:
+		flag = "--race"
+	}
+	if flag != "" {
+		return nil, fmt.Errorf("%s cannot be used with %s, which queries every provider on its own", flag, command)
+	}
+	return clientOptions(providers)
+}
+
+// primaryProvider returns the name or URL of the provider selected by
+// --provider-url or --provider.
+func primaryProvider() string {
+	if providerURL != "" {
+		return providerURL
+	}
+	return providerFlag
+}
+
+// anyODoH reports whether any of the named providers is an Oblivious DoH
+// target. Names that do not resolve are left to the query to report.
+func anyODoH(names []string) bool {
+	return slices.ContainsFunc(names, func(name string) bool {
+		p, err := query.LookupProvider(name)
+		return err == nil && p.Protocol == query.ProtocolODoH
+	})
+}
+
+// lookupProviders resolves the provider names or URLs given to flag.
+func lookupProviders(flag string, names []string) ([]query.Provider, error) {
+	providers := make([]query.Provider, 0, len(names))
+	for _, name := range names {
+		p, err := query.LookupProvider(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", flag, err)
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// newClient returns a query client configured from the command line flags.
+func newClient() (*query.Client, error) {
+	p, err := query.LookupProvider(providerFlag)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := clientOptions([]string{primaryProvider()})
+	if err != nil {
+		return nil, err
+	}
+	return query.NewClient(append([]query.Option{query.WithProvider(p), query.WithWhois(whoisFlag)}, opts...)...), nil
+}
+
+const usageTemplate = `Usage:
+  {{if .HasParent}}{{.UseLine}}{{else}}doh [flags] [query type] [domain name]{{end}}
+{{- if .HasAvailableSubCommands}}
+
+Commands:{{range .Commands}}{{if .IsAvailableCommand}}
+  {{rpad .Name .NamePadding}} {{.Short}}{{end}}{{end}}{{end}}
+
+Flags:
+{{.LocalFlags.FlagUsages}}
+{{- if .HasAvailableInheritedFlags}}
+Global Flags:
+{{.InheritedFlags.FlagUsages}}{{end}}`
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(version, commit string) {
 	appVersion = version
 	appCommit = commit
-	rootCmd.SetUsageTemplate("Usage:\n  doh [flags] [query type] [domain name]\n\nFlags:\n{{.LocalFlags.FlagUsages}}")
+	rootCmd.SetUsageTemplate(usageTemplate)
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
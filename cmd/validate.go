@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mxssl/doh/query"
+	"github.com/spf13/cobra"
+)
+
+var validateJSON bool
+
+func init() {
+	validateCmd.Flags().BoolVar(&validateJSON, "json", false, "output the result in JSON format")
+	rootCmd.AddCommand(validateCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:          "validate [query type] [domain name]",
+	Short:        "Validate the DNSSEC chain of trust of an answer locally",
+	Long:         "Validate follows DS and DNSKEY records from the root trust anchor down to the answer through the configured provider and verifies every signature and NSEC/NSEC3 denial proof locally. The query type defaults to A.",
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queryType, name := "A", args[0]
+		if len(args) == 2 {
+			queryType, name = args[0], args[1]
+		}
+
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		result, err := client.Validate(context.Background(), name, queryType)
+		if err != nil {
+			return err
+		}
+		format := query.FormatText
+		if validateJSON {
+			format = query.FormatJSON
+		}
+		if err := query.OutputValidation(result, format); err != nil {
+			return err
+		}
+		if result.Status == query.ValidationBogus {
+			return fmt.Errorf("%s %s is bogus", result.Name, result.Type)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/mxssl/doh/query"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval time.Duration
+	watchJSON     bool
+)
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 0, "query at this fixed interval instead of when the shortest TTL expires")
+	watchCmd.Flags().BoolVar(&watchJSON, "json", false, "print every change as a JSON line")
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:          "watch [query type] [domain name]",
+	Short:        "Re-query a name when its TTL expires and report changes",
+	Long:         "Watch repeats the query when the shortest TTL of the response expires, or every --interval, and prints the added and removed records whenever the answer changes. It runs until interrupted.",
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := newClient()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		format := query.FormatText
+		if watchJSON {
+			format = query.FormatNDJSON
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return client.Watch(ctx, args[1], args[0], watchInterval, func(change query.WatchChange) error {
+			return query.OutputWatchChange(change, format)
+		})
+	},
+}
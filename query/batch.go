@@ -0,0 +1,300 @@
+package query
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BatchQuery is a single query read from batch input.
+type BatchQuery struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// BatchResult is the outcome of one BatchQuery. Output is set for
+// successful queries and for DNS error rcodes; Err is set on failure.
+type BatchResult struct {
+	Index  int
+	Query  BatchQuery
+	Output *JSONOutput
+	Err    error
+}
+
+// BatchReader parses batch input one query at a time. Every non-empty line
+// is either "type name" or a JSON object such as
+// {"type":"A","name":"example.com"}. Lines starting with '#' are comments.
+type BatchReader struct {
+	scanner *bufio.Scanner
+	lineNo  int
+}
+
+// NewBatchReader returns a reader of the batch input in r.
+func NewBatchReader(r io.Reader) *BatchReader {
+	return &BatchReader{scanner: bufio.NewScanner(r)}
+}
+
+// Next returns the next query, or io.EOF at the end of the input.
+func (br *BatchReader) Next() (BatchQuery, error) {
+	for br.scanner.Scan() {
+		br.lineNo++
+		line := strings.TrimSpace(br.scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var q BatchQuery
+		if strings.HasPrefix(line, "{") {
+			if err := json.Unmarshal([]byte(line), &q); err != nil {
+				return BatchQuery{}, fmt.Errorf("line %d: invalid JSON: %w", br.lineNo, err)
+			}
+		} else {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				return BatchQuery{}, fmt.Errorf("line %d: expected \"type name\", got %q", br.lineNo, line)
+			}
+			q = BatchQuery{Type: fields[0], Name: fields[1]}
+		}
+		if q.Type == "" || q.Name == "" {
+			return BatchQuery{}, fmt.Errorf("line %d: both type and name are required", br.lineNo)
+		}
+		return q, nil
+	}
+	if err := br.scanner.Err(); err != nil {
+		return BatchQuery{}, fmt.Errorf("read batch input error: %w", err)
+	}
+	return BatchQuery{}, io.EOF
+}
+
+// ReadBatch parses all of the batch input in r, in the format read by
+// BatchReader.
+func ReadBatch(r io.Reader) ([]BatchQuery, error) {
+	var queries []BatchQuery
+	br := NewBatchReader(r)
+	for {
+		q, err := br.Next()
+		if err == io.EOF {
+			return queries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+}
+
+// Batch resolves queries with at most workers concurrent requests and calls
+// emit for every result. With ordered set, results are emitted in input
+// order; otherwise as soon as they complete. emit is never called
+// concurrently, and an error from emit stops the batch.
+func (c *Client) Batch(ctx context.Context, queries []BatchQuery, workers int, ordered bool, emit func(BatchResult) error) error {
+	next := 0
+	return c.batch(ctx, func() (BatchQuery, error) {
+		if next == len(queries) {
+			return BatchQuery{}, io.EOF
+		}
+		next++
+		return queries[next-1], nil
+	}, workers, ordered, emit)
+}
+
+// BatchFrom is like Batch but reads the queries from br while earlier ones
+// are resolved, so results are emitted before the input ends and the input
+// is never held in memory. Invalid input stops the batch: the queries read
+// before it are still resolved and emitted, and the parse error is
+// returned.
+func (c *Client) BatchFrom(ctx context.Context, br *BatchReader, workers int, ordered bool, emit func(BatchResult) error) error {
+	return c.batch(ctx, br.Next, workers, ordered, emit)
+}
+
+// batch feeds the queries returned by next, until io.EOF, to a pool of
+// workers and emits their results.
+func (c *Client) batch(ctx context.Context, next func() (BatchQuery, error), workers int, ordered bool, emit func(BatchResult) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan BatchResult)
+	results := make(chan BatchResult)
+	readErr := make(chan error, 1)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for {
+				var job BatchResult
+				select {
+				case j, ok := <-jobs:
+					if !ok {
+						return
+					}
+					job = j
+				case <-ctx.Done():
+					// The reader may be blocked on input that never comes.
+					return
+				}
+				job.Output, job.Err = c.Query(ctx, job.Query.Name, job.Query.Type)
+				results <- job
+			}
+		})
+	}
+	go func() {
+		defer close(jobs)
+		for i := 0; ; i++ {
+			q, err := next()
+			if err != nil {
+				if err != io.EOF {
+					readErr <- err
+				}
+				return
+			}
+			select {
+			case jobs <- BatchResult{Index: i, Query: q}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var emitErr error
+	pending := make(map[int]BatchResult)
+	nextIndex := 0
+	for res := range results {
+		if emitErr != nil {
+			continue // drain so workers can exit
+		}
+		if !ordered {
+			emitErr = emit(res)
+		} else {
+			pending[res.Index] = res
+			for emitErr == nil {
+				r, ok := pending[nextIndex]
+				if !ok {
+					break
+				}
+				delete(pending, nextIndex)
+				nextIndex++
+				emitErr = emit(r)
+			}
+		}
+		if emitErr != nil {
+			cancel()
+		}
+	}
+	if emitErr != nil {
+		return emitErr
+	}
+	select {
+	case err := <-readErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// Batch output formats
+const (
+	BatchFormatText  = "text"
+	BatchFormatJSONL = "jsonl"
+	BatchFormatCSV   = "csv"
+)
+
+// BatchWriter renders batch results as text, JSON Lines or CSV.
+type BatchWriter struct {
+	w      io.Writer
+	format string
+	csv    *csv.Writer
+}
+
+// NewBatchWriter returns a writer for the given format.
+func NewBatchWriter(w io.Writer, format string) (*BatchWriter, error) {
+	bw := &BatchWriter{w: w, format: format}
+	switch format {
+	case BatchFormatText, BatchFormatJSONL:
+	case BatchFormatCSV:
+		bw.csv = csv.NewWriter(w)
+		if err := bw.csv.Write([]string{"query_type", "query_name", "status", "name", "type", "ttl", "data", "error"}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown batch format: %s (valid formats: text, jsonl, csv)", format)
+	}
+	return bw, nil
+}
+
+// Write renders a single result.
+func (bw *BatchWriter) Write(res BatchResult) error {
+	var output JSONOutput
+	if res.Output != nil {
+		output = *res.Output
+	}
+	errText := ""
+	if res.Err != nil {
+		errText = res.Err.Error()
+		var rcodeErr RcodeError
+		if !errors.As(res.Err, &rcodeErr) {
+			output = JSONOutput{}
+		}
+	}
+
+	switch bw.format {
+	case BatchFormatJSONL:
+		output.Error = errText
+		line, err := json.Marshal(QueryOutput{QueryType: res.Query.Type, QueryName: res.Query.Name, JSONOutput: output})
+		if err != nil {
+			return fmt.Errorf("json marshal error: %w", err)
+		}
+		_, err = fmt.Fprintf(bw.w, "%s\n", line)
+		return err
+	case BatchFormatCSV:
+		status := output.StatusName
+		if len(output.Records) == 0 {
+			if err := bw.csv.Write([]string{res.Query.Type, res.Query.Name, status, "", "", "", "", errText}); err != nil {
+				return err
+			}
+		}
+		for _, r := range output.Records {
+			row := []string{res.Query.Type, res.Query.Name, status, r.Name, r.TypeName, strconv.Itoa(r.TTL), r.Data, errText}
+			if err := bw.csv.Write(row); err != nil {
+				return err
+			}
+		}
+		// Flush every result so that rows stream out like the other formats.
+		return bw.Flush()
+	default:
+		if res.Err != nil && output.StatusName == "" {
+			_, err := fmt.Fprintf(bw.w, ";; %s %s: error: %s\n", res.Query.Name, strings.ToUpper(res.Query.Type), errText)
+			return err
+		}
+		if _, err := fmt.Fprintf(bw.w, ";; %s %s: %s\n", res.Query.Name, strings.ToUpper(res.Query.Type), output.StatusName); err != nil {
+			return err
+		}
+		for _, r := range output.Records {
+			if _, err := fmt.Fprintf(bw.w, "%s\t%d\t%s\t%s\n", r.Name, r.TTL, r.TypeName, r.Data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Flush writes any buffered output.
+func (bw *BatchWriter) Flush() error {
+	if bw.csv == nil {
+		return nil
+	}
+	bw.csv.Flush()
+	return bw.csv.Error()
+}
@@ -0,0 +1,246 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadBatch(t *testing.T) {
+	input := `# audit list
+a example.com
+
+{"type":"MX","name":"example.org"}
+  aaaa   example.net
+`
+	got, err := ReadBatch(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []BatchQuery{
+		{Type: "a", Name: "example.com"},
+		{Type: "MX", Name: "example.org"},
+		{Type: "aaaa", Name: "example.net"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected queries: %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("unexpected query %d; got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadBatchErrors(t *testing.T) {
+	for input, want := range map[string]string{
+		"a\n":                     `line 1: expected "type name"`,
+		"a b\na b c\n":            `line 2: expected "type name"`,
+		`{"type":"A"` + "\n":      "line 1: invalid JSON",
+		`{"name":"x.com"}` + "\n": "line 1: both type and name are required",
+	} {
+		_, err := ReadBatch(strings.NewReader(input))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("unexpected error for %q; got %v, want %q", input, err, want)
+		}
+	}
+}
+
+// newBatchServer answers A queries with the address encoded in the name,
+// answering earlier names more slowly so completion order differs from
+// input order.
+func newBatchServer(t *testing.T, inFlight, maxInFlight *int32) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(inFlight, 1)
+		defer atomic.AddInt32(inFlight, -1)
+		for {
+			m := atomic.LoadInt32(maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(maxInFlight, m, n) {
+				break
+			}
+		}
+
+		var i int
+		name := r.URL.Query().Get("name")
+		if _, err := fmt.Sscanf(name, "host%d.example.com", &i); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(time.Duration(5-i) * 5 * time.Millisecond)
+		_, _ = fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"%s.","type":1,"TTL":60,"data":"192.0.2.%d"}]}`, name, i)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientBatchOrdered(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := newBatchServer(t, &inFlight, &maxInFlight)
+
+	queries := make([]BatchQuery, 5)
+	for i := range queries {
+		queries[i] = BatchQuery{Type: "A", Name: fmt.Sprintf("host%d.example.com", i)}
+	}
+
+	client := NewClient(WithProviderURL(srv.URL))
+	var order []int
+	err := client.Batch(context.Background(), queries, 2, true, func(res BatchResult) error {
+		if res.Err != nil {
+			t.Errorf("unexpected error for %s: %v", res.Query.Name, res.Err)
+		}
+		order = append(order, res.Index)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, idx := range order {
+		if idx != i {
+			t.Fatalf("results not in input order: %v", order)
+		}
+	}
+	if len(order) != len(queries) {
+		t.Fatalf("expected %d results, got %d", len(queries), len(order))
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("expected at most 2 concurrent requests, got %d", maxInFlight)
+	}
+}
+
+func TestClientBatchStopsOnEmitError(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := newBatchServer(t, &inFlight, &maxInFlight)
+
+	queries := make([]BatchQuery, 5)
+	for i := range queries {
+		queries[i] = BatchQuery{Type: "A", Name: fmt.Sprintf("host%d.example.com", i)}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := NewClient(WithProviderURL(srv.URL)).Batch(context.Background(), queries, 5, false, func(BatchResult) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("expected batch to stop after the first emit error; err=%v calls=%d", err, calls)
+	}
+}
+
+func TestClientBatchFromStreams(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := newBatchServer(t, &inFlight, &maxInFlight)
+
+	r, w := io.Pipe()
+	emitted := make(chan BatchResult)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewClient(WithProviderURL(srv.URL)).BatchFrom(context.Background(), NewBatchReader(r), 2, true, func(res BatchResult) error {
+			emitted <- res
+			return nil
+		})
+	}()
+
+	// The first result has to arrive while the input is still open.
+	_, _ = io.WriteString(w, "A host1.example.com\n")
+	select {
+	case res := <-emitted:
+		if res.Err != nil || res.Output.Records[0].Data != "192.0.2.1" {
+			t.Fatalf("unexpected result: %+v", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no result before the end of the input")
+	}
+
+	_, _ = io.WriteString(w, "A host2.example.com\nbad line here\nA host3.example.com\n")
+	_ = w.Close()
+	if res := <-emitted; res.Index != 1 || res.Err != nil {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestBatchWriterFormats(t *testing.T) {
+	ok := BatchResult{
+		Query: BatchQuery{Type: "a", Name: "example.com"},
+		Output: &JSONOutput{StatusName: "NOERROR", Records: []DNSRecord{
+			{Name: "example.com.", Type: 1, TypeName: "A", TTL: 60, Data: "192.0.2.1"},
+		}},
+	}
+	nx := BatchResult{
+		Query:  BatchQuery{Type: "a", Name: "missing.example.com"},
+		Output: &JSONOutput{Status: 3, StatusName: "NXDOMAIN"},
+		Err:    RcodeError{Code: 3},
+	}
+	failed := BatchResult{Query: BatchQuery{Type: "a", Name: "down.example.com"}, Err: errors.New("request do error: timeout")}
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{format: BatchFormatText, want: []string{
+			";; example.com A: NOERROR\nexample.com.\t60\tA\t192.0.2.1\n",
+			";; missing.example.com A: NXDOMAIN\n",
+			";; down.example.com A: error: request do error: timeout\n",
+		}},
+		{format: BatchFormatCSV, want: []string{
+			"query_type,query_name,status,name,type,ttl,data,error\n",
+			"a,example.com,NOERROR,example.com.,A,60,192.0.2.1,\n",
+			"a,missing.example.com,NXDOMAIN,,,,,NXDomain: Non-Existent Domain (rcode: 3)\n",
+			"a,down.example.com,,,,,,request do error: timeout\n",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewBatchWriter(&buf, tt.format)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, res := range []BatchResult{ok, nx, failed} {
+				if err := w.Write(res); err != nil {
+					t.Fatalf("write error: %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("flush error: %v", err)
+			}
+			if got := buf.String(); got != strings.Join(tt.want, "") {
+				t.Fatalf("unexpected output:\n%s", got)
+			}
+		})
+	}
+
+	var buf bytes.Buffer
+	w, _ := NewBatchWriter(&buf, BatchFormatJSONL)
+	_ = w.Write(ok)
+	_ = w.Write(failed)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON lines, got %q", buf.String())
+	}
+	var first, second map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first["query_name"] != "example.com" || first["records"] == nil {
+		t.Fatalf("unexpected first line %q: %v", lines[0], err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil || second["error"] != "request do error: timeout" {
+		t.Fatalf("unexpected second line %q: %v", lines[1], err)
+	}
+
+	if _, err := NewBatchWriter(&buf, "xml"); err == nil {
+		t.Fatal("expected error for unknown format")
+	}
+}
@@ -0,0 +1,226 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Benchmark measures the query latency of several providers. Providers are
+// benchmarked one after another so they do not compete for bandwidth.
+type Benchmark struct {
+	Providers []string
+	// Names and Types are combined round-robin into the queries sent.
+	Names []string
+	Types []string
+	// Count is the number of queries sent to each provider.
+	Count       int
+	Concurrency int
+	// Cold opens a new connection for every query. Otherwise connections
+	// are reused and warmed up by a query that is not measured.
+	Cold bool
+	// Options are applied to every client before its provider. WithFailover
+	// and WithRace are ignored, as every provider is measured on its own.
+	Options []Option
+}
+
+// BenchResult holds the statistics of one provider.
+type BenchResult struct {
+	Provider string `json:"provider"`
+	Queries  int    `json:"queries"`
+	Errors   int    `json:"errors"`
+	// ErrorRate is the share of queries that got no response at all.
+	ErrorRate float64 `json:"error_rate"`
+	// Latency is computed over the queries that got a response.
+	Latency BenchLatency `json:"latency_ms"`
+	// Rcodes counts the responses by rcode name.
+	Rcodes map[string]int `json:"rcodes"`
+	// FirstError is an example of the errors counted in Errors.
+	FirstError string `json:"first_error,omitempty"`
+}
+
+// BenchLatency summarizes latencies in milliseconds.
+type BenchLatency struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Max    float64 `json:"max"`
+}
+
+// Run benchmarks every provider in turn.
+func (b *Benchmark) Run(ctx context.Context) ([]BenchResult, error) {
+	if len(b.Names) == 0 || len(b.Types) == 0 {
+		return nil, errors.New("benchmark needs at least one name and type")
+	}
+	if b.Count < 1 {
+		return nil, errors.New("benchmark needs at least one query per provider")
+	}
+	for _, t := range b.Types {
+		if _, err := parseDNSType(t); err != nil {
+			return nil, err
+		}
+	}
+	provs := make([]Provider, len(b.Providers))
+	for i, name := range b.Providers {
+		var err error
+		if provs[i], err = LookupProvider(name); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]BenchResult, 0, len(provs))
+	for i, p := range provs {
+		res := b.benchProvider(ctx, p)
+		res.Provider = b.Providers[i]
+		results = append(results, res)
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// benchProvider sends Count queries to p and collects the statistics.
+func (b *Benchmark) benchProvider(ctx context.Context, p Provider) BenchResult {
+	workers := max(b.Concurrency, 1)
+	opts := append(slices.Clone(b.Options), soloProvider(p))
+	if !p.HTTP3 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = workers
+		transport.DisableKeepAlives = b.Cold
+		opts = append(opts, WithHTTPClient(&http.Client{Transport: transport}))
+		defer transport.CloseIdleConnections()
+	}
+
+	var shared *Client
+	if !b.Cold {
+		shared = NewClient(opts...)
+		defer func() {
+			_ = shared.Close()
+		}()
+		_, _ = shared.Query(ctx, b.Names[0], b.Types[0])
+	}
+
+	res := BenchResult{Queries: b.Count, Rcodes: make(map[string]int)}
+	var latencies []time.Duration
+	var mu sync.Mutex
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for i := range jobs {
+				c := shared
+				if c == nil {
+					c = NewClient(opts...)
+				}
+				name, qtype := b.Names[i%len(b.Names)], b.Types[i/len(b.Names)%len(b.Types)]
+				start := time.Now()
+				output, err := c.Query(ctx, name, qtype)
+				elapsed := time.Since(start)
+				if shared == nil {
+					_ = c.Close()
+				}
+
+				var rcodeErr RcodeError
+				if errors.As(err, &rcodeErr) {
+					output, err = &rcodeErr.Response, nil
+				}
+				mu.Lock()
+				if err != nil {
+					res.Errors++
+					if res.FirstError == "" {
+						res.FirstError = err.Error()
+					}
+				} else {
+					res.Rcodes[output.StatusName]++
+					latencies = append(latencies, elapsed)
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	for i := range b.Count {
+		if ctx.Err() != nil {
+			res.Queries = i
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if res.Queries > 0 {
+		res.ErrorRate = float64(res.Errors) / float64(res.Queries)
+	}
+	res.Latency = summarizeLatencies(latencies)
+	return res
+}
+
+// summarizeLatencies computes nearest-rank percentiles of latencies.
+func summarizeLatencies(latencies []time.Duration) BenchLatency {
+	if len(latencies) == 0 {
+		return BenchLatency{}
+	}
+	slices.Sort(latencies)
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(latencies)))) - 1
+		return milliseconds(latencies[max(i, 0)])
+	}
+	return BenchLatency{
+		Min:    milliseconds(latencies[0]),
+		Median: percentile(0.5),
+		P95:    percentile(0.95),
+		P99:    percentile(0.99),
+		Max:    milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// OutputBenchmark prints benchmark results as a table or in JSON format.
+func OutputBenchmark(results []BenchResult, format string) error {
+	if format == FormatJSON {
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("json marshal error: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PROVIDER\tQUERIES\tERRORS\tMIN\tMEDIAN\tP95\tP99\tRCODES")
+	for _, r := range results {
+		rcodes := make([]string, 0, len(r.Rcodes))
+		for _, name := range slices.Sorted(maps.Keys(r.Rcodes)) {
+			rcodes = append(rcodes, fmt.Sprintf("%s=%d", name, r.Rcodes[name]))
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d (%.1f%%)\t%.1fms\t%.1fms\t%.1fms\t%.1fms\t%s\n",
+			r.Provider, r.Queries, r.Errors, r.ErrorRate*100,
+			r.Latency.Min, r.Latency.Median, r.Latency.P95, r.Latency.P99, strings.Join(rcodes, " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Print(buf.String())
+	for _, r := range results {
+		if r.FirstError != "" {
+			fmt.Printf("%s: first error: %s\n", r.Provider, r.FirstError)
+		}
+	}
+	return nil
+}
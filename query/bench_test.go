@@ -0,0 +1,88 @@
+package query
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestSummarizeLatencies(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i >= 1; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	got := summarizeLatencies(latencies)
+	want := BenchLatency{Min: 1, Median: 50, P95: 95, P99: 99, Max: 100}
+	if got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if got := summarizeLatencies(nil); got != (BenchLatency{}) {
+		t.Fatalf("unexpected summary of no latencies: %+v", got)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		if q.Questions[0].Name.String() == "missing.example." {
+			return packResponse(t, dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: q.ID, RCode: dnsmessage.RCodeNameError},
+				Questions: q.Questions,
+			})
+		}
+		return answerA(t, q)
+	})
+
+	b := &Benchmark{
+		Providers:   []string{srv.URL, "http://127.0.0.1:1/dns-query"},
+		Names:       []string{"example.com", "missing.example"},
+		Types:       []string{"A", "AAAA"},
+		Count:       20,
+		Concurrency: 4,
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	ok, down := results[0], results[1]
+	if ok.Errors != 0 || ok.Rcodes["NOERROR"] != 10 || ok.Rcodes["NXDOMAIN"] != 10 || ok.Latency.Max < ok.Latency.Min {
+		t.Fatalf("unexpected result: %+v", ok)
+	}
+	if down.Errors != 20 || down.ErrorRate != 1 || down.FirstError == "" || len(down.Rcodes) != 0 {
+		t.Fatalf("unexpected result: %+v", down)
+	}
+}
+
+func TestBenchmarkConnections(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(wireHandler(t, http.MethodGet, answerA))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		cold bool
+		want int32
+	}{{false, 1}, {true, 5}} {
+		conns.Store(0)
+		b := &Benchmark{Providers: []string{srv.URL}, Names: []string{"example.com"}, Types: []string{"A"}, Count: 5, Cold: tt.cold}
+		if _, err := b.Run(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := conns.Load(); got != tt.want {
+			t.Fatalf("cold=%v: got %d connections, want %d", tt.cold, got, tt.want)
+		}
+	}
+}
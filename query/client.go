@@ -0,0 +1,335 @@
+package query
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// DefaultTimeout bounds a single query when no other timeout is configured.
+const DefaultTimeout = 10 * time.Second
+
+// Client resolves DNS queries through a DNS-over-HTTPS, DNS-over-TLS,
+// DNS-over-QUIC or plain DNS provider and returns the parsed response
+// instead of printing it.
+type Client struct {
+	provider        Provider
+	httpClient      *http.Client
+	tlsConfig       *tls.Config
+	timeout         time.Duration
+	enableWhois     bool
+	request         requestOptions
+	trace           bool
+	traceDelegation bool
+	verbose         bool
+	retries         int
+	retryBackoff    time.Duration
+	failover        []Provider
+	fallbacks       []*Client
+	race            []Provider
+	racers          []*Client
+	odohProxy       string
+	conns           *connPool
+	quic            *quicSession
+	http3           *http3.Transport
+	odoh            *odohState
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithProvider sets the provider used for queries.
+func WithProvider(p Provider) Option {
+	return func(c *Client) {
+		c.provider = p
+	}
+}
+
+// WithProviderURL sets the endpoint URL while keeping the configured protocol.
+func WithProviderURL(url string) Option {
+	return func(c *Client) {
+		c.provider.URL = url
+	}
+}
+
+// WithODoHProxy sets the proxy used to relay Oblivious DoH queries. It
+// replaces Provider.Proxy of every ODoH provider of the client, including
+// the WithFailover and WithRace ones, and is ignored by other protocols.
+func WithODoHProxy(proxy string) Option {
+	return func(c *Client) {
+		c.odohProxy = proxy
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for requests. A nil client means
+// http.DefaultClient, or an HTTP/3 client for providers with HTTP3 set.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used by DNS-over-TLS, DNS-over-QUIC
+// and HTTP/3 connections. A nil config means the system roots and default
+// settings.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithClientSubnet sends prefix as EDNS Client Subnet (RFC 7871) so the
+// answer is tailored to that network. A zero-length prefix such as
+// 0.0.0.0/0 asks the resolver not to use the client address.
+func WithClientSubnet(prefix netip.Prefix) Option {
+	return func(c *Client) {
+		c.request.clientSubnet = prefix.Masked()
+	}
+}
+
+// WithDNSSEC sets the DNSSEC OK (DO) bit so the resolver returns RRSIG,
+// NSEC and NSEC3 records with the answer.
+func WithDNSSEC(enable bool) Option {
+	return func(c *Client) {
+		c.request.dnssec = enable
+	}
+}
+
+// WithCheckingDisabled sets the Checking Disabled (CD) bit so the resolver
+// returns answers without validating them, including bogus ones.
+func WithCheckingDisabled(enable bool) Option {
+	return func(c *Client) {
+		c.request.checkingDisabled = enable
+	}
+}
+
+// WithTimeout bounds every query. A zero timeout disables the limit and
+// leaves cancellation to the caller's context.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithWhois enables WHOIS lookups for A and AAAA answer records.
+func WithWhois(enable bool) Option {
+	return func(c *Client) {
+		c.enableWhois = enable
+	}
+}
+
+// NewClient returns a Client for the default provider, modified by opts.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		provider:     builtinProviders[DefaultProvider],
+		timeout:      DefaultTimeout,
+		retryBackoff: DefaultRetryBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.provider = c.relayed(c.provider)
+	for _, p := range c.failover {
+		c.fallbacks = append(c.fallbacks, c.forProvider(p))
+	}
+	for _, p := range c.race {
+		c.racers = append(c.racers, c.forProvider(p))
+	}
+	c.setupTransports()
+	return c
+}
+
+// forProvider returns a copy of c with its own connections that sends
+// queries to p.
+func (c *Client) forProvider(p Provider) *Client {
+	fc := *c
+	fc.provider = c.relayed(p)
+	fc.failover, fc.fallbacks = nil, nil
+	fc.race, fc.racers = nil, nil
+	fc.setupTransports()
+	return &fc
+}
+
+// relayed returns p with the WithODoHProxy proxy when p is an Oblivious
+// DoH target.
+func (c *Client) relayed(p Provider) Provider {
+	if c.odohProxy != "" && p.Protocol == ProtocolODoH {
+		p.Proxy = c.odohProxy
+	}
+	return p
+}
+
+// setupTransports creates the connection state of the client.
+func (c *Client) setupTransports() {
+	c.conns = &connPool{}
+	c.quic = &quicSession{}
+	c.odoh = &odohState{}
+	if c.provider.HTTP3 && c.httpClient == nil {
+		c.http3 = &http3.Transport{TLSClientConfig: c.tlsClientConfig("", http3.NextProtoH3)}
+		c.httpClient = &http.Client{Transport: c.http3}
+	}
+}
+
+// Query resolves name for the given record type ("a", "MX", "TYPE65", "65").
+// When the server answers with a non-zero rcode, Query returns the parsed
+// response together with an RcodeError.
+func (c *Client) Query(ctx context.Context, name, queryType string) (*JSONOutput, error) {
+	lookupCtx := ctx
+	var rec *timingRecorder
+	if c.verbose {
+		lookupCtx, rec = withTiming(ctx)
+	}
+	res, answered, latency, err := c.resolve(lookupCtx, name, queryType)
+	if err != nil {
+		return nil, err
+	}
+
+	output := makeJSONOutput(res, c.enableWhois)
+	if len(c.fallbacks) > 0 || len(c.racers) > 0 {
+		output.Provider = answered.URL
+	}
+	if len(c.racers) > 0 {
+		output.Latency = milliseconds(latency)
+	}
+	if rec != nil {
+		output.Timing = rec.finish(answered.Protocol)
+	}
+	if c.trace {
+		output.Trace = traceChain(name, output.Records)
+		if c.traceDelegation {
+			output.Trace.Delegation, err = c.delegationPath(ctx, name)
+			if err != nil {
+				output.Trace.Error = err.Error()
+			}
+		}
+	}
+	if res.Status != 0 {
+		return &output, RcodeError{Code: res.Status, Response: output}
+	}
+	return &output, nil
+}
+
+// resolve sends the query with the retries, failover and race providers of
+// the client and returns the response with the provider that answered and,
+// for races, its latency.
+func (c *Client) resolve(ctx context.Context, name, queryType string) (dohResponse, Provider, time.Duration, error) {
+	if len(c.racers) > 0 {
+		return c.lookupRace(ctx, name, queryType)
+	}
+	res, answered, err := c.lookupFailover(ctx, name, queryType)
+	return res, answered, 0, err
+}
+
+// lookupOnce runs a single exchange bounded by the client timeout.
+func (c *Client) lookupOnce(ctx context.Context, name, queryType string) (dohResponse, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return c.exchange(ctx, name, queryType)
+}
+
+// exchange sends the query using the provider's protocol.
+func (c *Client) exchange(ctx context.Context, name, queryType string) (dohResponse, error) {
+	if c.provider.Protocol == ProtocolJSON || c.provider.Protocol == "" {
+		return c.queryJSON(ctx, name, queryType)
+	}
+	msg, err := c.exchangeWire(ctx, name, queryType)
+	if err != nil {
+		return dohResponse{}, err
+	}
+	res, err := parseWireResponse(msg)
+	res.wire = msg
+	return res, err
+}
+
+// exchangeWire sends the query using the provider's protocol and returns the
+// raw wire-format response. The provider must not be a JSON provider; see
+// Provider.wireProvider.
+func (c *Client) exchangeWire(ctx context.Context, name, queryType string) ([]byte, error) {
+	switch c.provider.Protocol {
+	case ProtocolDoT:
+		return c.queryDoT(ctx, name, queryType)
+	case ProtocolDoQ:
+		return c.queryDoQ(ctx, name, queryType)
+	case ProtocolODoH:
+		return c.queryODoH(ctx, name, queryType)
+	case ProtocolUDP:
+		return c.queryUDP(ctx, name, queryType)
+	case ProtocolTCP:
+		return c.queryTCP(ctx, name, queryType)
+	default:
+		return c.queryWire(ctx, name, queryType)
+	}
+}
+
+// Close closes the connections kept open for reuse by stream, QUIC and
+// HTTP/3 transports. The client remains usable and will dial new
+// connections as needed.
+func (c *Client) Close() error {
+	errs := []error{c.conns.close(), c.quic.close()}
+	if c.http3 != nil {
+		c.http3.CloseIdleConnections()
+	}
+	for _, fc := range slices.Concat(c.fallbacks, c.racers) {
+		errs = append(errs, fc.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// doRequest performs an HTTP request and returns the body of a 200 response.
+func (c *Client) doRequest(req *http.Request) ([]byte, error) {
+	httpClient := c.httpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	for name, value := range c.provider.Headers {
+		req.Header.Set(name, value)
+	}
+	rec := timingFrom(req.Context())
+	if rec != nil {
+		req = req.WithContext(rec.trace(req.Context()))
+	}
+
+	response, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request do error: %w", err)
+	}
+	if rec != nil {
+		rec.response(response)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body error: %w", err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, HTTPStatusError{StatusCode: response.StatusCode, Status: response.Status, Body: string(content)}
+	}
+	return content, nil
+}
+
+// HTTPStatusError is returned when a DNS-over-HTTPS server answers with a
+// status other than 200 OK.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e HTTPStatusError) Error() string {
+	return fmt.Sprintf("error response status: %s, body: %s", e.Status, e.Body)
+}
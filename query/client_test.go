@@ -0,0 +1,91 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientQueryReturnsOutputWithoutPrinting(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/dns-json")
+		_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":120,"data":"192.0.2.1"}]}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolJSON}))
+	var output *JSONOutput
+	out := captureStdout(t, func() {
+		var err error
+		output, err = client.Query(context.Background(), "example.com", "A")
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	if out != "" {
+		t.Fatalf("expected no stdout output, got %q", out)
+	}
+	if len(output.Records) != 1 || output.Records[0].Data != "192.0.2.1" {
+		t.Fatalf("unexpected records: %+v", output.Records)
+	}
+}
+
+func TestClientQueryReturnsOutputWithRcodeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Status":3,"Comment":"no such name"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProviderURL(srv.URL))
+	output, err := client.Query(context.Background(), "missing.example.com", "A")
+
+	var rcodeErr RcodeError
+	if !errors.As(err, &rcodeErr) || rcodeErr.Code != 3 {
+		t.Fatalf("expected NXDOMAIN RcodeError, got %v", err)
+	}
+	if output == nil || output.StatusName != "NXDOMAIN" || len(output.Comments) != 1 {
+		t.Fatalf("expected parsed response alongside error, got %+v", output)
+	}
+}
+
+func TestClientUsesConfiguredHTTPClient(t *testing.T) {
+	var called bool
+	httpClient := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		called = true
+		if got, want := req.URL.Host, "resolver.test"; got != want {
+			t.Errorf("unexpected host; got %q, want %q", got, want)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"Status":0}`)),
+			Header:     make(http.Header),
+		}, nil
+	})}
+
+	client := NewClient(WithProviderURL("https://resolver.test/resolve"), WithHTTPClient(httpClient))
+	if _, err := client.Query(context.Background(), "example.com", "A"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !called {
+		t.Fatal("expected configured HTTP client to be used")
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProviderURL(srv.URL), WithTimeout(50*time.Millisecond))
+	_, err := client.Query(context.Background(), "example.com", "A")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
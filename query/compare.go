@@ -0,0 +1,216 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// Comparison is the outcome of resolving one query through several
+// providers.
+type Comparison struct {
+	Name    string          `json:"name"`
+	Type    string          `json:"type"`
+	Agree   bool            `json:"agree"`
+	Results []CompareResult `json:"results"`
+	// Differences lists the answers not returned by every provider that
+	// responded.
+	Differences []CompareDifference `json:"differences,omitempty"`
+}
+
+// CompareResult is the normalized answer of one provider.
+type CompareResult struct {
+	Provider string `json:"provider"`
+	Status   string `json:"status,omitempty"`
+	// Answers are the answer records as "name TYPE data", without TTLs or
+	// trailing dots, sorted.
+	Answers []string `json:"answers"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// CompareDifference is an answer returned by some providers but not others.
+type CompareDifference struct {
+	Answer  string   `json:"answer"`
+	Present []string `json:"present"`
+	Missing []string `json:"missing"`
+}
+
+// Compare resolves name through every provider concurrently and diffs the
+// answers. Providers are registered names or endpoint URLs as accepted by
+// ParseProviderURL. opts are applied to every client before its provider;
+// WithFailover and WithRace are ignored, as every provider has to answer on
+// its own.
+// RRSIG records are left out of the comparison, as are differences in TTL,
+// letter case of owner names, trailing dots and quoting of TXT strings.
+func Compare(ctx context.Context, names []string, name, queryType string, opts ...Option) (*Comparison, error) {
+	if len(names) < 2 {
+		return nil, errors.New("compare needs at least two providers")
+	}
+	provs := make([]Provider, len(names))
+	for i, n := range names {
+		p, err := LookupProvider(n)
+		if err != nil {
+			return nil, err
+		}
+		provs[i] = p
+	}
+	clients := make([]*Client, len(names))
+	for i, p := range provs {
+		clients[i] = NewClient(append(slices.Clone(opts), soloProvider(p))...)
+	}
+	defer func() {
+		for _, c := range clients {
+			_ = c.Close()
+		}
+	}()
+
+	cmp := &Comparison{Name: name, Type: strings.ToUpper(queryType), Results: make([]CompareResult, len(names))}
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Go(func() {
+			cmp.Results[i] = compareQuery(ctx, c, names[i], name, queryType)
+		})
+	}
+	wg.Wait()
+
+	cmp.diff()
+	return cmp, nil
+}
+
+func compareQuery(ctx context.Context, c *Client, provider, name, queryType string) CompareResult {
+	result := CompareResult{Provider: provider}
+	output, err := c.Query(ctx, name, queryType)
+	var rcodeErr RcodeError
+	if errors.As(err, &rcodeErr) {
+		output, err = &rcodeErr.Response, nil
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = output.StatusName
+	result.Answers = []string{}
+	for _, r := range output.Records {
+		if r.Type != rrsigType {
+			result.Answers = append(result.Answers, normalizeRecord(r))
+		}
+	}
+	slices.Sort(result.Answers)
+	result.Answers = slices.Compact(result.Answers)
+	return result
+}
+
+// normalizeRecord renders r for comparison as "name TYPE data" with the
+// owner name lower-cased and the data normalized by normalizeData.
+func normalizeRecord(r DNSRecord) string {
+	owner := strings.ToLower(strings.TrimSuffix(r.Name, "."))
+	return fmt.Sprintf("%s %s %s", owner, r.TypeName, normalizeData(r.Type, r.Data))
+}
+
+// normalizeData drops trailing dots from names, canonicalizes IP addresses
+// and unquotes TXT strings, so that the same record data from JSON and
+// wire-format providers compares equal.
+func normalizeData(rrtype int, data string) string {
+	switch rrtype {
+	case 1, 28:
+		if addr, err := netip.ParseAddr(data); err == nil {
+			return addr.String()
+		}
+		return data
+	case 16, 99:
+		if txt, ok := parseRData(rrtype, data).(*TXTData); ok {
+			return txt.Text
+		}
+		return data
+	}
+	fields := strings.Fields(data)
+	for i, f := range fields {
+		if len(f) > 1 {
+			fields[i] = strings.TrimSuffix(f, ".")
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// diff fills Agree and Differences from the results.
+func (cmp *Comparison) diff() {
+	cmp.Agree = true
+	var answered []CompareResult
+	for _, r := range cmp.Results {
+		if r.Error != "" {
+			cmp.Agree = false
+			continue
+		}
+		answered = append(answered, r)
+	}
+
+	var all []string
+	for _, r := range answered {
+		if r.Status != answered[0].Status {
+			cmp.Agree = false
+		}
+		all = append(all, r.Answers...)
+	}
+	slices.Sort(all)
+	for _, answer := range slices.Compact(all) {
+		var d CompareDifference
+		for _, r := range answered {
+			if _, found := slices.BinarySearch(r.Answers, answer); found {
+				d.Present = append(d.Present, r.Provider)
+			} else {
+				d.Missing = append(d.Missing, r.Provider)
+			}
+		}
+		if len(d.Missing) > 0 {
+			d.Answer = answer
+			cmp.Differences = append(cmp.Differences, d)
+			cmp.Agree = false
+		}
+	}
+}
+
+// OutputComparison prints a comparison in text or JSON format.
+func OutputComparison(cmp *Comparison, format string) error {
+	if format == FormatJSON {
+		b, err := json.MarshalIndent(cmp, "", "  ")
+		if err != nil {
+			return fmt.Errorf("json marshal error: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	for _, r := range cmp.Results {
+		if r.Error != "" {
+			fmt.Printf("%s: %v\n", blue(r.Provider), red("error: "+r.Error))
+			continue
+		}
+		fmt.Printf("%s: %v\n", blue(r.Provider), green(r.Status))
+		for _, answer := range r.Answers {
+			fmt.Printf("  %v\n", green(answer))
+		}
+	}
+	if len(cmp.Differences) > 0 {
+		fmt.Println(blue("differences:"))
+		for _, d := range cmp.Differences {
+			fmt.Printf("  %s: returned by %s, missing from %s\n", d.Answer, strings.Join(d.Present, ", "), strings.Join(d.Missing, ", "))
+		}
+	}
+	if cmp.Agree {
+		fmt.Printf("%s: %v\n", blue("result"), green("providers agree"))
+	} else {
+		fmt.Printf("%s: %v\n", blue("result"), red("providers disagree"))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestNormalizeRecord(t *testing.T) {
+	for _, tt := range []struct {
+		record dohRecord
+		want   string
+	}{
+		{dohRecord{Name: "Example.com.", Type: 5, Data: "google.com."}, "example.com CNAME google.com"},
+		{dohRecord{Name: "example.com", Type: 5, Data: "google.com"}, "example.com CNAME google.com"},
+		{dohRecord{Name: "example.com", Type: 28, Data: "2001:0db8:0:0::1"}, "example.com AAAA 2001:db8::1"},
+		{dohRecord{Name: "example.com", Type: 15, Data: "10 mx.example.com."}, "example.com MX 10 mx.example.com"},
+		{dohRecord{Name: "example.com", Type: 16, Data: `"v=spf1 -all."`}, "example.com TXT v=spf1 -all."},
+		{dohRecord{Name: "example.com", Type: 16, Data: "v=spf1 -all."}, "example.com TXT v=spf1 -all."},
+		{dohRecord{Name: "example.com", Type: 16, Data: `"say \"hi\"" "!"`}, `example.com TXT say "hi"!`},
+	} {
+		if got := normalizeRecord(makeDNSRecord(tt.record, false)); got != tt.want {
+			t.Errorf("normalizeRecord(%+v) = %q, want %q", tt.record, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	a := newWireServer(t, http.MethodGet, answerA)
+	b := newWireServer(t, http.MethodGet, answerA)
+	nx := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		return packResponse(t, dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, RCode: dnsmessage.RCodeNameError},
+			Questions: q.Questions,
+		})
+	})
+
+	cmp, err := Compare(context.Background(), []string{a.URL, b.URL}, "example.com", "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cmp.Agree || len(cmp.Differences) != 0 || cmp.Results[0].Answers[0] != "example.com A 192.0.2.1" {
+		t.Fatalf("unexpected comparison: %+v", cmp)
+	}
+
+	cmp, err = Compare(context.Background(), []string{a.URL, b.URL, nx.URL}, "example.com", "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cmp.Agree || len(cmp.Differences) != 1 || cmp.Results[2].Status != "NXDOMAIN" {
+		t.Fatalf("unexpected comparison: %+v", cmp)
+	}
+	if d := cmp.Differences[0]; len(d.Present) != 2 || len(d.Missing) != 1 || d.Missing[0] != nx.URL {
+		t.Fatalf("unexpected difference: %+v", d)
+	}
+}
+
+func TestCompareTXT(t *testing.T) {
+	newServer := func(data string) *Client {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, `{"Status":0,"Answer":[{"name":"example.com.","type":16,"TTL":300,"data":%q}]}`, data)
+		}))
+		t.Cleanup(srv.Close)
+		return NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolJSON}))
+	}
+	quoted := newServer(`"v=spf1 include:_spf.example.com -all"`)
+	unquoted := newServer("v=spf1 include:_spf.example.com -all")
+
+	cmp := &Comparison{Results: []CompareResult{
+		compareQuery(context.Background(), quoted, "quoted", "example.com", "TXT"),
+		compareQuery(context.Background(), unquoted, "unquoted", "example.com", "TXT"),
+	}}
+	cmp.diff()
+	if !cmp.Agree || cmp.Results[0].Answers[0] != "example.com TXT v=spf1 include:_spf.example.com -all" {
+		t.Fatalf("unexpected comparison: %+v", cmp)
+	}
+}
+
+func TestCompareProviders(t *testing.T) {
+	if _, err := Compare(context.Background(), []string{"cloudflare"}, "example.com", "A"); err == nil {
+		t.Fatal("expected error for a single provider")
+	}
+	if _, err := Compare(context.Background(), []string{"cloudflare", "nope"}, "example.com", "A"); err == nil {
+		t.Fatal("expected error for an unknown provider")
+	}
+}
@@ -0,0 +1,88 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// outputDig prints a response in the layout of dig: header flags followed by
+// the question, answer, authority and additional sections in zone-file
+// presentation format.
+func outputDig(output JSONOutput) error {
+	status := output.StatusName
+	if status == "" {
+		status = rcodeName(output.Status)
+	}
+	fmt.Printf(";; ->>HEADER<<- opcode: QUERY, status: %s\n", status)
+	fmt.Printf(";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		digFlags(output.Flags), len(output.Question), len(output.Records), len(output.Authority), len(output.Additional))
+
+	for _, comment := range output.Comments {
+		fmt.Printf(";; COMMENT: %s\n", comment)
+	}
+	if s := output.ClientSubnet; s != nil {
+		fmt.Printf("; CLIENT-SUBNET: %s/%d/%d\n", s.Address, s.SourcePrefix, s.ScopePrefix)
+	}
+
+	if len(output.Question) > 0 {
+		fmt.Println()
+		fmt.Println(";; QUESTION SECTION:")
+		for _, q := range output.Question {
+			fmt.Printf(";%s\t\tIN\t%s\n", fqdn(q.Name), q.TypeName)
+		}
+	}
+	printDigSection("ANSWER", output.Records)
+	printDigSection("AUTHORITY", output.Authority)
+	printDigSection("ADDITIONAL", output.Additional)
+	if output.Provider != "" {
+		fmt.Println()
+		if output.Latency > 0 {
+			fmt.Printf(";; Query time: %.0f msec\n", output.Latency)
+		}
+		fmt.Printf(";; SERVER: %s\n", output.Provider)
+	}
+	return nil
+}
+
+func digFlags(f DNSFlags) string {
+	flags := []string{"qr"}
+	for _, flag := range []struct {
+		set  bool
+		name string
+	}{
+		{f.Truncated, "tc"},
+		{f.RecursionDesired, "rd"},
+		{f.RecursionAvailable, "ra"},
+		{f.AuthenticData, "ad"},
+		{f.CheckingDisabled, "cd"},
+	} {
+		if flag.set {
+			flags = append(flags, flag.name)
+		}
+	}
+	return strings.Join(flags, " ")
+}
+
+func printDigSection(name string, records []DNSRecord) {
+	if len(records) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf(";; %s SECTION:\n", name)
+	for _, r := range records {
+		fmt.Println(presentationRecord(r))
+	}
+}
+
+// presentationRecord formats a record as a zone-file line.
+func presentationRecord(r DNSRecord) string {
+	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s", fqdn(r.Name), r.TTL, r.TypeName, r.Data)
+}
+
+// outputShort prints only the data of the answer records, one per line.
+func outputShort(output JSONOutput) error {
+	for _, r := range output.Records {
+		fmt.Println(r.Data)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package query
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOutputDig(t *testing.T) {
+	output := JSONOutput{
+		Status:     0,
+		StatusName: "NOERROR",
+		Flags:      DNSFlags{RecursionDesired: true, RecursionAvailable: true, AuthenticData: true},
+		Question:   []DNSQuestion{{Name: "example.com.", Type: 15, TypeName: "MX"}},
+		Records:    []DNSRecord{{Name: "example.com", Type: 15, TypeName: "MX", TTL: 300, Data: "10 mail.example.com."}},
+		Additional: []DNSRecord{{Name: "mail.example.com.", Type: 1, TypeName: "A", TTL: 300, Data: "192.0.2.10"}},
+	}
+
+	out := captureStdout(t, func() {
+		if err := OutputResponse(output, FormatDig); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	want := `;; ->>HEADER<<- opcode: QUERY, status: NOERROR
+;; flags: qr rd ra ad; QUERY: 1, ANSWER: 1, AUTHORITY: 0, ADDITIONAL: 1
+
+;; QUESTION SECTION:
+;example.com.		IN	MX
+
+;; ANSWER SECTION:
+example.com.	300	IN	MX	10 mail.example.com.
+
+;; ADDITIONAL SECTION:
+mail.example.com.	300	IN	A	192.0.2.10
+`
+	if out != want {
+		t.Fatalf("unexpected dig output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestOutputDigShowsErrorStatus(t *testing.T) {
+	out := captureStdout(t, func() {
+		if err := OutputResponse(JSONOutput{Status: 3}, FormatDig); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	if !strings.Contains(out, "status: NXDOMAIN") || strings.Contains(out, "ANSWER SECTION") {
+		t.Fatalf("unexpected dig output: %s", out)
+	}
+}
+
+func TestDoFormatShort(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Status":0,"Answer":[
+			{"name":"www.example.com.","type":5,"TTL":60,"data":"example.com."},
+			{"name":"example.com.","type":1,"TTL":60,"data":"192.0.2.1"}
+		],"Authority":[{"name":"example.com.","type":2,"TTL":60,"data":"ns.example.com."}]}`))
+	}))
+	defer srv.Close()
+
+	out := captureStdout(t, func() {
+		if err := DoFormat("a", "www.example.com", false, FormatShort, DefaultProvider, WithProviderURL(srv.URL)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	if want := "example.com.\n192.0.2.1\n"; out != want {
+		t.Fatalf("unexpected short output; got %q, want %q", out, want)
+	}
+}
+
+func TestDoFormatProviderURL(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, answerA)
+
+	out := captureStdout(t, func() {
+		if err := DoFormat("a", "example.com", false, FormatShort, srv.URL+"/dns-query"); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	if want := "192.0.2.1\n"; out != want {
+		t.Fatalf("unexpected short output; got %q, want %q", out, want)
+	}
+}
+
+func TestDoFormatRejectsUnknownFormat(t *testing.T) {
+	err := DoFormat("a", "example.com", false, "xml", DefaultProvider)
+	if err == nil || !strings.Contains(err.Error(), "unknown output format: xml") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
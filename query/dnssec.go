@@ -0,0 +1,694 @@
+package query
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// rrsigType is the RRSIG record type.
+const rrsigType = 46
+
+// groupSignatures moves each RRSIG record directly after the RRset it
+// covers, so signatures are shown alongside the answers, NSEC and NSEC3
+// records they sign. Signatures that cover no record in records keep their
+// relative order at the end.
+func groupSignatures(records []DNSRecord) []DNSRecord {
+	var sigs, others []DNSRecord
+	for _, r := range records {
+		if r.Type == rrsigType {
+			sigs = append(sigs, r)
+		} else {
+			others = append(others, r)
+		}
+	}
+	if len(sigs) == 0 || len(others) == 0 {
+		return records
+	}
+
+	grouped := make([]DNSRecord, 0, len(records))
+	used := make([]bool, len(sigs))
+	for i, r := range others {
+		grouped = append(grouped, r)
+		if i+1 < len(others) && sameRRset(others[i+1], r) {
+			continue
+		}
+		for j, sig := range sigs {
+			if !used[j] && sameOwner(sig.Name, r.Name) && coveredType(sig) == r.Type {
+				grouped = append(grouped, sig)
+				used[j] = true
+			}
+		}
+	}
+	for j, sig := range sigs {
+		if !used[j] {
+			grouped = append(grouped, sig)
+		}
+	}
+	return grouped
+}
+
+// coveredType returns the type covered by an RRSIG record, or -1 when its
+// data cannot be parsed.
+func coveredType(sig DNSRecord) int {
+	parsed, ok := sig.Parsed.(*RRSIGData)
+	if !ok {
+		return -1
+	}
+	t, err := parseDNSType(parsed.TypeCovered)
+	if err != nil {
+		return -1
+	}
+	return int(t)
+}
+
+func sameRRset(a, b DNSRecord) bool {
+	return a.Type == b.Type && sameOwner(a.Name, b.Name)
+}
+
+// sameOwner compares owner names case-insensitively, ignoring the trailing
+// dot some providers omit.
+func sameOwner(a, b string) bool {
+	return strings.EqualFold(fqdn(a), fqdn(b))
+}
+
+// DNSSEC record types and flags used by validation.
+const (
+	dsType       = 43
+	nsecType     = 47
+	dnskeyType   = 48
+	nsec3Type    = 50
+	dnskeyZone   = 0x0100
+	dnskeyProto  = 3
+	maxNameHops  = 32
+	nsec3OptOut  = 0x01
+	nsec3SHA1    = 1
+	maxNameBytes = 255
+)
+
+// dnssecRR is a resource record in DNSSEC canonical form (RFC 4034 section
+// 6.2): names are uncompressed and in lower case.
+type dnssecRR struct {
+	name   []byte
+	rrtype uint16
+	class  uint16
+	ttl    uint32
+	rdata  []byte
+}
+
+// dnssecMsg holds the sections of a response needed for validation.
+type dnssecMsg struct {
+	rcode     int
+	answer    []dnssecRR
+	authority []dnssecRR
+}
+
+// rdataNameLayouts describes the rdata of types that embed domain names as
+// a sequence of fixed-size fields (n > 0), character strings (-1) and names
+// (0). These names may be compressed and are lowered in canonical form
+// (RFC 4034 section 6.2, amended by RFC 6840 section 5.1).
+var rdataNameLayouts = map[uint16][]int{
+	2:  {0},                // NS
+	3:  {0},                // MD
+	4:  {0},                // MF
+	5:  {0},                // CNAME
+	6:  {0, 0, 20},         // SOA
+	7:  {0},                // MB
+	8:  {0},                // MG
+	9:  {0},                // MR
+	12: {0},                // PTR
+	14: {0, 0},             // MINFO
+	15: {2, 0},             // MX
+	17: {0, 0},             // RP
+	18: {2, 0},             // AFSDB
+	21: {2, 0},             // RT
+	26: {2, 0, 0},          // PX
+	33: {6, 0},             // SRV
+	35: {4, -1, -1, -1, 0}, // NAPTR
+	36: {2, 0},             // KX
+	39: {0},                // DNAME
+}
+
+// parseDNSSECMessage decodes the answer and authority sections of a
+// wire-format response into canonical records.
+func parseDNSSECMessage(msg []byte) (dnssecMsg, error) {
+	if len(msg) < 12 {
+		return dnssecMsg{}, errors.New("message too short")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		return dnssecMsg{}, errors.New("message is not a response")
+	}
+	res := dnssecMsg{rcode: int(flags & 0x000F)}
+
+	off := 12
+	for range binary.BigEndian.Uint16(msg[4:]) {
+		var err error
+		if _, off, err = readMessageName(msg, off); err != nil {
+			return dnssecMsg{}, err
+		}
+		off += 4
+	}
+	var err error
+	if res.answer, off, err = readRRs(msg, off, int(binary.BigEndian.Uint16(msg[6:]))); err != nil {
+		return dnssecMsg{}, err
+	}
+	if res.authority, _, err = readRRs(msg, off, int(binary.BigEndian.Uint16(msg[8:]))); err != nil {
+		return dnssecMsg{}, err
+	}
+	return res, nil
+}
+
+func readRRs(msg []byte, off, count int) ([]dnssecRR, int, error) {
+	var rrs []dnssecRR
+	for range count {
+		name, next, err := readMessageName(msg, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		if next+10 > len(msg) {
+			return nil, 0, errShortRData
+		}
+		rr := dnssecRR{
+			name:   name,
+			rrtype: binary.BigEndian.Uint16(msg[next:]),
+			class:  binary.BigEndian.Uint16(msg[next+2:]),
+			ttl:    binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		if start+length > len(msg) {
+			return nil, 0, errShortRData
+		}
+		if rr.rdata, err = canonicalRData(msg, rr.rrtype, start, start+length); err != nil {
+			return nil, 0, err
+		}
+		rrs = append(rrs, rr)
+		off = start + length
+	}
+	return rrs, off, nil
+}
+
+// canonicalRData returns the rdata at msg[start:end] with embedded names
+// decompressed and lowered.
+func canonicalRData(msg []byte, rrtype uint16, start, end int) ([]byte, error) {
+	layout, ok := rdataNameLayouts[rrtype]
+	if !ok {
+		return bytes.Clone(msg[start:end]), nil
+	}
+	var rdata []byte
+	off := start
+	for _, n := range layout {
+		if n < 0 {
+			if off >= end {
+				return nil, errShortRData
+			}
+			n = 1 + int(msg[off])
+		}
+		if n > 0 {
+			if off+n > end {
+				return nil, errShortRData
+			}
+			rdata = append(rdata, msg[off:off+n]...)
+			off += n
+			continue
+		}
+		name, next, err := readMessageName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		rdata = append(rdata, name...)
+		off = next
+	}
+	if off > end {
+		return nil, errShortRData
+	}
+	return append(rdata, msg[off:end]...), nil
+}
+
+// readMessageName reads a possibly compressed name at off and returns it
+// in lower-case wire format along with the offset following it.
+func readMessageName(msg []byte, off int) ([]byte, int, error) {
+	var name []byte
+	next := -1
+	for hops := 0; ; {
+		if off >= len(msg) {
+			return nil, 0, errShortRData
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return append(name, 0), next, nil
+		case length&0xC0 == 0xC0:
+			if off+1 >= len(msg) {
+				return nil, 0, errShortRData
+			}
+			if hops++; hops > maxNameHops {
+				return nil, 0, errors.New("too many compression pointers")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+		case length&0xC0 != 0:
+			return nil, 0, fmt.Errorf("invalid label length %d", length)
+		default:
+			if off+1+length > len(msg) {
+				return nil, 0, errShortRData
+			}
+			name = append(name, byte(length))
+			name = append(name, bytes.ToLower(msg[off+1:off+1+length])...)
+			if len(name) >= maxNameBytes {
+				return nil, 0, errors.New("name too long")
+			}
+			off += 1 + length
+		}
+	}
+}
+
+// nameFromString converts a presentation-format name without escapes to
+// lower-case wire format.
+func nameFromString(s string) ([]byte, error) {
+	s = strings.TrimSuffix(s, ".")
+	var name []byte
+	if s != "" {
+		for label := range strings.SplitSeq(s, ".") {
+			if label == "" || len(label) > 63 {
+				return nil, fmt.Errorf("invalid domain name %q", s)
+			}
+			name = append(name, byte(len(label)))
+			name = append(name, strings.ToLower(label)...)
+		}
+	}
+	name = append(name, 0)
+	if len(name) > maxNameBytes {
+		return nil, fmt.Errorf("invalid domain name %q", s)
+	}
+	return name, nil
+}
+
+// nameString renders a wire-format name in presentation format.
+func nameString(name []byte) string {
+	r := rdataReader{data: name}
+	return r.name()
+}
+
+// nameLabels splits a wire-format name into its labels, excluding the root.
+func nameLabels(name []byte) [][]byte {
+	var labels [][]byte
+	for len(name) > 0 && name[0] != 0 && int(name[0]) < len(name) {
+		labels = append(labels, name[1:1+name[0]])
+		name = name[1+name[0]:]
+	}
+	return labels
+}
+
+// labelCount returns the RRSIG label count of a name: a leading wildcard
+// label is not counted (RFC 4034 section 3.1.3).
+func labelCount(name []byte) int {
+	labels := nameLabels(name)
+	if len(labels) > 0 && string(labels[0]) == "*" {
+		return len(labels) - 1
+	}
+	return len(labels)
+}
+
+// parentName strips the first label of name. The parent of the root is the
+// root.
+func parentName(name []byte) []byte {
+	if len(name) == 0 || name[0] == 0 {
+		return name
+	}
+	return name[1+name[0]:]
+}
+
+// ancestorName returns the ancestor of name with the given number of
+// labels.
+func ancestorName(name []byte, labels int) []byte {
+	for n := len(nameLabels(name)); n > labels; n-- {
+		name = parentName(name)
+	}
+	return name
+}
+
+// isSubdomain reports whether child equals parent or is below it.
+func isSubdomain(child, parent []byte) bool {
+	n := len(nameLabels(parent))
+	if len(nameLabels(child)) < n {
+		return false
+	}
+	return bytes.Equal(ancestorName(child, n), parent)
+}
+
+// compareNames orders names canonically (RFC 4034 section 6.1): label by
+// label from the root, comparing lower-case labels as byte strings.
+func compareNames(a, b []byte) int {
+	la, lb := nameLabels(a), nameLabels(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := bytes.Compare(bytes.ToLower(la[i]), bytes.ToLower(lb[j])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// rrset is a set of records with the same owner and type together with the
+// signatures covering them.
+type rrset struct {
+	name   []byte
+	rrtype uint16
+	rrs    []dnssecRR
+	sigs   []rrsig
+}
+
+// groupRRsets groups the records of a section into RRsets in order of
+// appearance and attaches the RRSIGs covering each set.
+func groupRRsets(section []dnssecRR) []*rrset {
+	var sets []*rrset
+	find := func(name []byte, rrtype uint16) *rrset {
+		for _, s := range sets {
+			if s.rrtype == rrtype && bytes.Equal(s.name, name) {
+				return s
+			}
+		}
+		return nil
+	}
+	for _, rr := range section {
+		if rr.rrtype == rrsigType {
+			continue
+		}
+		if s := find(rr.name, rr.rrtype); s != nil {
+			s.rrs = append(s.rrs, rr)
+		} else {
+			sets = append(sets, &rrset{name: rr.name, rrtype: rr.rrtype, rrs: []dnssecRR{rr}})
+		}
+	}
+	for _, rr := range section {
+		if rr.rrtype != rrsigType {
+			continue
+		}
+		sig, err := decodeRRSIG(rr.rdata)
+		if err != nil {
+			continue
+		}
+		if s := find(rr.name, sig.typeCovered); s != nil {
+			s.sigs = append(s.sigs, sig)
+		}
+	}
+	return sets
+}
+
+// findRRset returns the RRset of the given owner and type, or nil.
+func findRRset(sets []*rrset, name []byte, rrtype uint16) *rrset {
+	for _, s := range sets {
+		if s.rrtype == rrtype && bytes.Equal(s.name, name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// rrsig is a decoded RRSIG record.
+type rrsig struct {
+	typeCovered uint16
+	algorithm   uint8
+	labels      uint8
+	originalTTL uint32
+	expiration  uint32
+	inception   uint32
+	keyTag      uint16
+	signer      []byte
+	signature   []byte
+	// header is the rdata without the signature and with the signer name
+	// lowered, as it is signed (RFC 4034 section 3.1.8.1).
+	header []byte
+}
+
+func decodeRRSIG(rdata []byte) (rrsig, error) {
+	r := rdataReader{data: rdata}
+	sig := rrsig{
+		typeCovered: r.uint16(),
+		algorithm:   r.uint8(),
+		labels:      r.uint8(),
+		originalTTL: r.uint32(),
+		expiration:  r.uint32(),
+		inception:   r.uint32(),
+		keyTag:      r.uint16(),
+	}
+	sig.signer = bytes.ToLower(r.wireName())
+	sig.signature = r.rest()
+	if r.err != nil {
+		return rrsig{}, r.err
+	}
+	sig.header = append(bytes.Clone(rdata[:18]), sig.signer...)
+	return sig, nil
+}
+
+// dnskey is a decoded DNSKEY record.
+type dnskey struct {
+	flags     uint16
+	protocol  uint8
+	algorithm uint8
+	publicKey []byte
+	rdata     []byte
+	tag       uint16
+}
+
+func decodeDNSKEY(rdata []byte) (dnskey, error) {
+	r := rdataReader{data: rdata}
+	key := dnskey{flags: r.uint16(), protocol: r.uint8(), algorithm: r.uint8(), publicKey: r.rest(), rdata: rdata}
+	if r.err != nil {
+		return dnskey{}, r.err
+	}
+	key.tag = keyTag(key.flags, key.protocol, key.algorithm, key.publicKey)
+	return key, nil
+}
+
+// dsRecord is a decoded DS record.
+type dsRecord struct {
+	keyTag     uint16
+	algorithm  uint8
+	digestType uint8
+	digest     []byte
+}
+
+func decodeDS(rdata []byte) (dsRecord, error) {
+	r := rdataReader{data: rdata}
+	ds := dsRecord{keyTag: r.uint16(), algorithm: r.uint8(), digestType: r.uint8(), digest: r.rest()}
+	if r.err != nil {
+		return dsRecord{}, r.err
+	}
+	return ds, nil
+}
+
+// dsDigests maps DS digest types to their hash functions.
+var dsDigests = map[uint8]func() hash.Hash{
+	1: sha1.New,      // SHA-1
+	2: sha256.New,    // SHA-256
+	4: sha512.New384, // SHA-384
+}
+
+// supported reports whether the digest type and key algorithm of ds can be
+// checked.
+func (ds dsRecord) supported() bool {
+	_, ok := dsDigests[ds.digestType]
+	return ok && supportedAlgorithm(ds.algorithm)
+}
+
+// matches reports whether ds is the digest of key owned by zone.
+func (ds dsRecord) matches(zone []byte, key dnskey) bool {
+	newHash, ok := dsDigests[ds.digestType]
+	if !ok || ds.keyTag != key.tag || ds.algorithm != key.algorithm {
+		return false
+	}
+	h := newHash()
+	h.Write(zone)
+	h.Write(key.rdata)
+	return bytes.Equal(h.Sum(nil), ds.digest)
+}
+
+// signedData returns the data covered by sig for the records of set
+// (RFC 4034 section 3.1.8.1). Wildcard expansions are signed with the
+// wildcard owner name.
+func signedData(sig rrsig, set []dnssecRR) ([]byte, error) {
+	owner := set[0].name
+	labels := labelCount(owner)
+	if int(sig.labels) > labels {
+		return nil, errors.New("rrsig label count exceeds owner name")
+	}
+	if int(sig.labels) < labels {
+		owner = append([]byte{1, '*'}, ancestorName(owner, int(sig.labels))...)
+	}
+
+	rdatas := make([][]byte, 0, len(set))
+	for _, rr := range set {
+		rdatas = append(rdatas, rr.rdata)
+	}
+	slices.SortFunc(rdatas, bytes.Compare)
+	rdatas = slices.CompactFunc(rdatas, bytes.Equal)
+
+	data := bytes.Clone(sig.header)
+	for _, rdata := range rdatas {
+		data = append(data, owner...)
+		data = binary.BigEndian.AppendUint16(data, set[0].rrtype)
+		data = binary.BigEndian.AppendUint16(data, set[0].class)
+		data = binary.BigEndian.AppendUint32(data, sig.originalTTL)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(rdata)))
+		data = append(data, rdata...)
+	}
+	return data, nil
+}
+
+// verifyRRset checks that one of the signatures of set was made by one of
+// keys on behalf of zone and is valid at now. It returns the signature and
+// key that verified.
+func verifyRRset(set *rrset, zone []byte, keys []dnskey, now time.Time) (rrsig, dnskey, error) {
+	if len(set.sigs) == 0 {
+		return rrsig{}, dnskey{}, errors.New("no RRSIG")
+	}
+	err := fmt.Errorf("no DNSKEY of %s matches the RRSIG key tags", nameString(zone))
+	for _, sig := range set.sigs {
+		if !bytes.Equal(sig.signer, zone) {
+			err = fmt.Errorf("RRSIG signer %s is not %s", nameString(sig.signer), nameString(zone))
+			continue
+		}
+		if sigErr := checkSignatureTime(sig, now); sigErr != nil {
+			err = sigErr
+			continue
+		}
+		for _, key := range keys {
+			if key.tag != sig.keyTag || key.algorithm != sig.algorithm ||
+				key.flags&dnskeyZone == 0 || key.protocol != dnskeyProto {
+				continue
+			}
+			data, dataErr := signedData(sig, set.rrs)
+			if dataErr != nil {
+				return rrsig{}, dnskey{}, dataErr
+			}
+			if sigErr := verifySignature(sig.algorithm, key.publicKey, data, sig.signature); sigErr != nil {
+				err = fmt.Errorf("signature by key %d: %w", key.tag, sigErr)
+				continue
+			}
+			return sig, key, nil
+		}
+	}
+	return rrsig{}, dnskey{}, err
+}
+
+// checkSignatureTime compares the validity period of sig with now using
+// serial number arithmetic (RFC 4034 section 3.1.5).
+func checkSignatureTime(sig rrsig, now time.Time) error {
+	t := uint32(now.Unix())
+	if int32(t-sig.inception) < 0 {
+		return fmt.Errorf("signature not valid before %s", formatSignatureTime(sig.inception))
+	}
+	if int32(sig.expiration-t) < 0 {
+		return fmt.Errorf("signature expired at %s", formatSignatureTime(sig.expiration))
+	}
+	return nil
+}
+
+// DNSSEC algorithm numbers (RFC 8624).
+const (
+	algRSASHA1         = 5
+	algRSASHA1NSEC3    = 7
+	algRSASHA256       = 8
+	algRSASHA512       = 10
+	algECDSAP256SHA256 = 13
+	algECDSAP384SHA384 = 14
+	algED25519         = 15
+)
+
+var errUnsupportedAlgorithm = errors.New("unsupported algorithm")
+
+func supportedAlgorithm(alg uint8) bool {
+	switch alg {
+	case algRSASHA1, algRSASHA1NSEC3, algRSASHA256, algRSASHA512,
+		algECDSAP256SHA256, algECDSAP384SHA384, algED25519:
+		return true
+	}
+	return false
+}
+
+// verifySignature checks sig over data with a DNSKEY public key of the
+// given algorithm.
+func verifySignature(alg uint8, key, data, sig []byte) error {
+	switch alg {
+	case algRSASHA1, algRSASHA1NSEC3:
+		return verifyRSA(key, crypto.SHA1, data, sig)
+	case algRSASHA256:
+		return verifyRSA(key, crypto.SHA256, data, sig)
+	case algRSASHA512:
+		return verifyRSA(key, crypto.SHA512, data, sig)
+	case algECDSAP256SHA256:
+		return verifyECDSA(elliptic.P256(), key, crypto.SHA256, data, sig)
+	case algECDSAP384SHA384:
+		return verifyECDSA(elliptic.P384(), key, crypto.SHA384, data, sig)
+	case algED25519:
+		if len(key) != ed25519.PublicKeySize {
+			return errors.New("invalid Ed25519 key")
+		}
+		if !ed25519.Verify(key, data, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errUnsupportedAlgorithm
+}
+
+// verifyRSA checks a PKCS #1 v1.5 signature with a key in the RFC 3110
+// format: exponent length, exponent, modulus.
+func verifyRSA(key []byte, h crypto.Hash, data, sig []byte) error {
+	r := rdataReader{data: key}
+	expLen := int(r.uint8())
+	if expLen == 0 {
+		expLen = int(r.uint16())
+	}
+	exp := new(big.Int).SetBytes(r.bytes(expLen))
+	modulus := r.rest()
+	if r.err != nil || len(modulus) == 0 || !exp.IsInt64() || exp.Int64() > math.MaxInt32 {
+		return errors.New("invalid RSA key")
+	}
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(exp.Int64())}
+	digest := h.New()
+	digest.Write(data)
+	return rsa.VerifyPKCS1v15(pub, h, digest.Sum(nil), sig)
+}
+
+// verifyECDSA checks a signature made of r and s with a key made of the X
+// and Y coordinates (RFC 6605).
+func verifyECDSA(curve elliptic.Curve, key []byte, h crypto.Hash, data, sig []byte) error {
+	pub, err := ecdsa.ParseUncompressedPublicKey(curve, append([]byte{4}, key...))
+	if err != nil {
+		return fmt.Errorf("invalid ECDSA key: %w", err)
+	}
+	if len(sig)%2 != 0 {
+		return errors.New("invalid signature")
+	}
+	digest := h.New()
+	digest.Write(data)
+	r := new(big.Int).SetBytes(sig[:len(sig)/2])
+	s := new(big.Int).SetBytes(sig[len(sig)/2:])
+	if !ecdsa.Verify(pub, digest.Sum(nil), r, s) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestGroupSignatures(t *testing.T) {
+	records := makeDNSRecords([]dohRecord{
+		{Name: "example.com.", Type: 1, TTL: 300, Data: "192.0.2.1"},
+		{Name: "example.com.", Type: 1, TTL: 300, Data: "192.0.2.2"},
+		{Name: "example.com.", Type: 28, TTL: 300, Data: "2001:db8::1"},
+		{Name: "example.com.", Type: 46, TTL: 300, Data: "AAAA 13 2 300 20261101000000 20261018000000 12345 example.com. c2ln"},
+		{Name: "Example.com", Type: 46, TTL: 300, Data: "a 13 2 300 20261101000000 20261018000000 12345 example.com. c2ln"},
+		{Name: "other.example.", Type: 46, TTL: 300, Data: "MX 13 2 300 20261101000000 20261018000000 12345 example. c2ln"},
+	}, false)
+
+	got := groupSignatures(records)
+	want := []struct {
+		typ     int
+		covered string
+	}{{1, ""}, {1, ""}, {46, "A"}, {28, ""}, {46, "AAAA"}, {46, "MX"}}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected records: %+v", got)
+	}
+	for i, w := range want {
+		if got[i].Type != w.typ {
+			t.Fatalf("record %d: got type %d, want %d", i, got[i].Type, w.typ)
+		}
+		if w.covered != "" && got[i].Parsed.(*RRSIGData).TypeCovered != w.covered {
+			t.Fatalf("record %d: got %+v, want signature over %s", i, got[i].Parsed, w.covered)
+		}
+	}
+}
+
+func TestParseDNSSECRData(t *testing.T) {
+	sig, ok := parseRData(46, "A 13 2 300 20261101000000 20261018000000 12345 example.com. c2ln bmF0dXJl").(*RRSIGData)
+	if !ok || sig.TypeCovered != "A" || sig.KeyTag != 12345 || sig.SignerName != "example.com." || sig.Signature != "c2lnbmF0dXJl" {
+		t.Fatalf("unexpected RRSIG: %+v", sig)
+	}
+	nsec, ok := parseRData(47, "www.example.com. A RRSIG NSEC").(*NSECData)
+	if !ok || nsec.NextDomain != "www.example.com." || len(nsec.Types) != 3 {
+		t.Fatalf("unexpected NSEC: %+v", nsec)
+	}
+	nsec3, ok := parseRData(50, "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR NS SOA RRSIG").(*NSEC3Data)
+	if !ok || nsec3.HashAlgorithm != 1 || nsec3.Salt != "-" || len(nsec3.Types) != 3 {
+		t.Fatalf("unexpected NSEC3: %+v", nsec3)
+	}
+}
+
+func TestCanonicalRDataNAPTR(t *testing.T) {
+	rdata := slices.Concat([]byte{0, 10, 0, 20}, []byte("\x01U"), []byte("\x07E2U+SIP"), []byte("\x00"), []byte("\x04_SIP\x04_UDP\x07EXAMPLE\x00"))
+	got, err := canonicalRData(rdata, 35, 0, len(rdata))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := slices.Concat([]byte{0, 10, 0, 20}, []byte("\x01U"), []byte("\x07E2U+SIP"), []byte("\x00"), []byte("\x04_sip\x04_udp\x07example\x00"))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if _, err := canonicalRData(rdata[:6], 35, 0, 6); err == nil {
+		t.Fatal("expected error for truncated rdata")
+	}
+}
+
+func TestClientDNSSECJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("do"); got != "1" {
+			t.Errorf("unexpected do parameter %q", got)
+		}
+		if got := r.URL.Query().Get("cd"); got != "1" {
+			t.Errorf("unexpected cd parameter %q", got)
+		}
+		w.Header().Set("Content-Type", "application/dns-json")
+		_, _ = w.Write([]byte(`{"Status":0,"CD":true,"Answer":[
+			{"name":"example.com.","type":46,"TTL":300,"data":"A 13 2 300 20261101000000 20261018000000 12345 example.com. c2ln"},
+			{"name":"example.com.","type":1,"TTL":300,"data":"192.0.2.1"}]}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProviderURL(srv.URL), WithDNSSEC(true), WithCheckingDisabled(true))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !output.Flags.CheckingDisabled || len(output.Records) != 2 || output.Records[1].Type != 46 {
+		t.Fatalf("unexpected output: %+v", output)
+	}
+}
+
+func TestClientDNSSECWire(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		if !q.Header.CheckingDisabled {
+			t.Error("expected CD bit in query")
+		}
+		var dnssecOK bool
+		for _, r := range q.Additionals {
+			if r.Header.Type == dnsmessage.TypeOPT {
+				dnssecOK = r.Header.DNSSECAllowed()
+			}
+		}
+		if !dnssecOK {
+			t.Error("expected DO bit in query")
+		}
+		return answerA(t, q)
+	})
+
+	client := NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire, Method: http.MethodGet}),
+		WithDNSSEC(true), WithCheckingDisabled(true))
+	if _, err := client.Query(context.Background(), "example.com", "A"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
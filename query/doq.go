@@ -0,0 +1,122 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// doqALPN is the TLS application protocol of DNS over QUIC (RFC 9250
+// section 4.1).
+const doqALPN = "doq"
+
+// doqNoError is the DOQ_NO_ERROR application error code used when closing
+// a connection.
+const doqNoError = 0x0
+
+// quicSession holds the QUIC connection shared by DoQ queries. Every query
+// uses its own stream, so a single connection serves concurrent queries.
+type quicSession struct {
+	mu   sync.Mutex
+	conn *quic.Conn
+}
+
+// get returns the open connection or dials a new one. reused reports whether
+// the connection was opened by an earlier query.
+func (s *quicSession) get(ctx context.Context, dial func(context.Context) (*quic.Conn, error)) (conn *quic.Conn, reused bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn.Context().Err() == nil {
+		return s.conn, true, nil
+	}
+	conn, err = dial(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	s.conn = conn
+	return conn, false, nil
+}
+
+// drop forgets conn so the next query dials a new connection.
+func (s *quicSession) drop(conn *quic.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == conn {
+		s.conn = nil
+	}
+	_ = conn.CloseWithError(doqNoError, "")
+}
+
+// close closes the shared connection.
+func (s *quicSession) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.CloseWithError(doqNoError, "")
+	s.conn = nil
+	return err
+}
+
+// queryDoQ resolves domain over DNS over QUIC, sending the query on a new
+// stream of the shared connection.
+func (c *Client) queryDoQ(ctx context.Context, domain, queryType string) ([]byte, error) {
+	// The message ID must be zero (RFC 9250 section 4.2.1), as produced by
+	// newWireQuery.
+	msg, err := c.newWireQuery(domain, queryType)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		conn, reused, err := c.quic.get(ctx, c.dialDoQ)
+		if err != nil {
+			return nil, fmt.Errorf("dial error: %w", err)
+		}
+		content, err := exchangeQUIC(ctx, conn, msg)
+		if err != nil {
+			if reused && ctx.Err() == nil && conn.Context().Err() != nil {
+				c.quic.drop(conn)
+				continue // the server closed the idle connection
+			}
+			return nil, fmt.Errorf("exchange error: %w", err)
+		}
+		return content, nil
+	}
+}
+
+// exchangeQUIC sends msg on a new stream and reads the response. The send
+// side is closed after the query to signal that no more data follows.
+func exchangeQUIC(ctx context.Context, conn *quic.Conn, msg []byte) ([]byte, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer bindDeadline(ctx, stream)()
+
+	if err := writeStreamMessage(stream, msg); err != nil {
+		return nil, err
+	}
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+	return readStreamMessage(stream)
+}
+
+// dialDoQ opens a QUIC connection to the provider.
+func (c *Client) dialDoQ(ctx context.Context) (*quic.Conn, error) {
+	u, err := url.Parse(c.provider.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = dotPort
+	}
+	return quic.DialAddr(ctx, net.JoinHostPort(u.Hostname(), port), c.tlsClientConfig(u.Hostname(), doqALPN), nil)
+}
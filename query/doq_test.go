@@ -0,0 +1,172 @@
+package query
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// doqServer is an in-process DNS-over-QUIC server.
+type doqServer struct {
+	listener *quic.Listener
+	roots    *x509.CertPool
+	accepted atomic.Int32
+	wg       sync.WaitGroup
+}
+
+func newDoQServer(t *testing.T, answer func(t *testing.T, q dnsmessage.Message) []byte) *doqServer {
+	t.Helper()
+	cfg, roots := testCertificate(t)
+	cfg.NextProtos = []string{doqALPN}
+	l, err := quic.ListenAddr("127.0.0.1:0", cfg, nil)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &doqServer{listener: l, roots: roots}
+
+	s.wg.Go(func() {
+		for {
+			conn, err := l.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			s.wg.Go(func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					s.wg.Go(func() {
+						defer func() {
+							_ = stream.Close()
+						}()
+						raw, err := readStreamMessage(stream)
+						if err != nil {
+							t.Errorf("failed to read query: %v", err)
+							return
+						}
+						var q dnsmessage.Message
+						if err := q.Unpack(raw); err != nil {
+							t.Errorf("failed to unpack query: %v", err)
+							return
+						}
+						if q.ID != 0 {
+							t.Errorf("expected message ID 0, got %d", q.ID)
+						}
+						_ = writeStreamMessage(stream, answer(t, q))
+					})
+				}
+			})
+		}
+	})
+	t.Cleanup(func() {
+		_ = l.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func TestParseProviderURLQUIC(t *testing.T) {
+	p, err := ParseProviderURL("quic://dns.adguard-dns.com")
+	if err != nil || p.Protocol != ProtocolDoQ {
+		t.Fatalf("unexpected provider %+v: %v", p, err)
+	}
+
+	p, err = ParseProviderURL("h3://cloudflare-dns.com/dns-query")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Protocol != ProtocolWire || !p.HTTP3 || p.URL != "https://cloudflare-dns.com/dns-query" {
+		t.Fatalf("unexpected provider: %+v", p)
+	}
+
+	err = Provider{URL: "tls://dns.example", Protocol: ProtocolDoT, HTTP3: true}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "http3 requires") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClientDoQ(t *testing.T) {
+	srv := newDoQServer(t, answerA)
+	client := NewClient(WithProvider(Provider{URL: "quic://" + srv.listener.Addr().String(), Protocol: ProtocolDoQ}),
+		WithTLSConfig(&tls.Config{RootCAs: srv.roots}))
+	defer func() {
+		_ = client.Close()
+	}()
+
+	results := client.QueryTypes(context.Background(), "example.com", []string{"A", "AAAA", "MX"})
+	for _, res := range results {
+		if res.Err != nil {
+			t.Fatalf("unexpected error for %s: %v", res.Query.Type, res.Err)
+		}
+		if len(res.Output.Records) != 1 || res.Output.Records[0].Data != "192.0.2.1" {
+			t.Fatalf("unexpected records: %+v", res.Output.Records)
+		}
+	}
+	if n := srv.accepted.Load(); n != 1 {
+		t.Fatalf("expected queries to share one connection, got %d", n)
+	}
+}
+
+func TestClientDoQOverridesNextProtos(t *testing.T) {
+	srv := newDoQServer(t, answerA)
+	client := NewClient(WithProvider(Provider{URL: "quic://" + srv.listener.Addr().String(), Protocol: ProtocolDoQ}),
+		WithTLSConfig(&tls.Config{RootCAs: srv.roots, NextProtos: []string{"h3"}}))
+
+	// The client always offers "doq", so a mismatched config still connects.
+	if _, err := client.Query(context.Background(), "example.com", "A"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = client.Close()
+}
+
+func TestClientHTTP3(t *testing.T) {
+	cfg, roots := testCertificate(t)
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(cfg),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor != 3 {
+				t.Errorf("expected HTTP/3 request, got %s", r.Proto)
+			}
+			wireHandler(t, http.MethodGet, answerA)(w, r)
+		}),
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	go func() {
+		_ = srv.Serve(conn)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	p, err := ParseProviderURL("h3://" + conn.LocalAddr().String() + "/dns-query")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := NewClient(WithProvider(p), WithTLSConfig(&tls.Config{RootCAs: roots}))
+	defer func() {
+		_ = client.Close()
+	}()
+
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(output.Records) != 1 || output.Records[0].Data != "192.0.2.1" {
+		t.Fatalf("unexpected records: %+v", output.Records)
+	}
+}
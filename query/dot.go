@@ -0,0 +1,213 @@
+package query
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// dotPort is the default DNS-over-TLS port (RFC 7858 section 3.1).
+const dotPort = "853"
+
+// maxIdleConns bounds the connections kept open for reuse.
+const maxIdleConns = 8
+
+// connPool keeps idle stream connections so consecutive queries can skip
+// the TCP and TLS handshakes.
+type connPool struct {
+	mu   sync.Mutex
+	idle []net.Conn
+}
+
+// get returns an idle connection or dials a new one. reused reports whether
+// the connection was taken from the pool.
+func (p *connPool) get(ctx context.Context, dial func(context.Context) (net.Conn, error)) (conn net.Conn, reused bool, err error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		conn = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+	}
+	p.mu.Unlock()
+	if conn != nil {
+		return conn, true, nil
+	}
+	conn, err = dial(ctx)
+	return conn, false, err
+}
+
+// put returns conn to the pool, closing it when the pool is full.
+func (p *connPool) put(conn net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle) >= maxIdleConns {
+		_ = conn.Close()
+		return
+	}
+	p.idle = append(p.idle, conn)
+}
+
+// close closes all idle connections.
+func (p *connPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, conn := range p.idle {
+		errs = append(errs, conn.Close())
+	}
+	p.idle = nil
+	return errors.Join(errs...)
+}
+
+// queryDoT resolves domain over a DNS-over-TLS connection, reusing idle
+// connections from earlier queries.
+func (c *Client) queryDoT(ctx context.Context, domain, queryType string) ([]byte, error) {
+	msg, err := c.newStreamQuery(domain, queryType)
+	if err != nil {
+		return nil, err
+	}
+	content, err := c.exchangePooled(ctx, msg, c.dialDoT)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// newStreamQuery builds a wire-format query with a random ID. Unlike RFC
+// 8484, a connection carries several queries, so the ID is used to match
+// the response.
+func (c *Client) newStreamQuery(domain, queryType string) ([]byte, error) {
+	msg, err := c.newWireQuery(domain, queryType)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(msg, uint16(rand.Uint32()))
+	return msg, nil
+}
+
+// exchangePooled sends msg over a pooled stream connection, dialing a new
+// one when no idle connection is available. A reused connection that fails
+// is assumed to have been closed by the server and is replaced.
+func (c *Client) exchangePooled(ctx context.Context, msg []byte, dial func(context.Context) (net.Conn, error)) ([]byte, error) {
+	for {
+		conn, reused, err := c.conns.get(ctx, dial)
+		if err != nil {
+			return nil, fmt.Errorf("dial error: %w", err)
+		}
+		content, err := exchangeStream(ctx, conn, msg)
+		if err != nil {
+			_ = conn.Close()
+			if reused && ctx.Err() == nil {
+				continue
+			}
+			return nil, fmt.Errorf("exchange error: %w", err)
+		}
+		c.conns.put(conn)
+		return content, nil
+	}
+}
+
+// dialDoT opens a TLS connection to the provider, verifying the server
+// certificate against Provider.ServerName or the URL host.
+func (c *Client) dialDoT(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(c.provider.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = dotPort
+	}
+
+	d := tls.Dialer{Config: c.tlsClientConfig(u.Hostname())}
+	return d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+}
+
+// tlsClientConfig returns the TLS configuration for a connection to host,
+// with the server name taken from the client config, Provider.ServerName or
+// host, in that order.
+func (c *Client) tlsClientConfig(host string, nextProtos ...string) *tls.Config {
+	cfg := &tls.Config{}
+	if c.tlsConfig != nil {
+		cfg = c.tlsConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = c.provider.ServerName
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if len(nextProtos) > 0 {
+		cfg.NextProtos = nextProtos
+	}
+	return cfg
+}
+
+// deadlineSetter is implemented by TCP, TLS and QUIC streams.
+type deadlineSetter interface {
+	SetDeadline(t time.Time) error
+}
+
+// bindDeadline applies the context deadline to conn and interrupts blocked
+// reads and writes when ctx is cancelled. The returned function releases
+// the context and clears the deadline.
+func bindDeadline(ctx context.Context, conn deadlineSetter) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	return func() {
+		stop()
+		_ = conn.SetDeadline(time.Time{})
+	}
+}
+
+// exchangeStream sends msg over a DNS over TCP or TLS connection and reads
+// the response, which must carry the query ID.
+func exchangeStream(ctx context.Context, conn net.Conn, msg []byte) ([]byte, error) {
+	defer bindDeadline(ctx, conn)()
+
+	if err := writeStreamMessage(conn, msg); err != nil {
+		return nil, err
+	}
+	content, err := readStreamMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) < 2 || binary.BigEndian.Uint16(content) != binary.BigEndian.Uint16(msg) {
+		return nil, errors.New("response ID does not match query")
+	}
+	return content, nil
+}
+
+// writeStreamMessage writes msg with the two-byte length prefix used on
+// stream transports (RFC 1035 section 4.2.2).
+func writeStreamMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readStreamMessage reads one length-prefixed message.
+func readStreamMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	content := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
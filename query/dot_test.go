@@ -0,0 +1,204 @@
+package query
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dotServer is an in-process DNS-over-TLS server using the httptest
+// certificate, which is valid for example.com and 127.0.0.1.
+type dotServer struct {
+	listener    net.Listener
+	roots       *x509.CertPool
+	accepted    atomic.Int32
+	serverNames sync.Map
+	wg          sync.WaitGroup
+}
+
+// testCertificate returns a server TLS config with the httptest certificate
+// and a pool that trusts it.
+func testCertificate(t *testing.T) (*tls.Config, *x509.CertPool) {
+	t.Helper()
+	certSrv := httptest.NewTLSServer(nil)
+	certSrv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(certSrv.Certificate())
+	return &tls.Config{Certificates: certSrv.TLS.Certificates}, roots
+}
+
+func newDoTServer(t *testing.T, answer func(t *testing.T, q dnsmessage.Message) []byte) *dotServer {
+	t.Helper()
+	cfg, roots := testCertificate(t)
+	s := &dotServer{roots: roots}
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		s.serverNames.Store(hello.ServerName, true)
+		return nil, nil
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s.listener = l
+
+	s.wg.Go(func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.accepted.Add(1)
+			s.wg.Go(func() {
+				defer func() {
+					_ = conn.Close()
+				}()
+				for {
+					var length [2]byte
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					raw := make([]byte, binary.BigEndian.Uint16(length[:]))
+					if _, err := io.ReadFull(conn, raw); err != nil {
+						return
+					}
+					var q dnsmessage.Message
+					if err := q.Unpack(raw); err != nil {
+						t.Errorf("failed to unpack query: %v", err)
+						return
+					}
+					resp := answer(t, q)
+					binary.BigEndian.PutUint16(length[:], uint16(len(resp)))
+					if _, err := conn.Write(append(length[:], resp...)); err != nil {
+						return
+					}
+				}
+			})
+		}
+	})
+	t.Cleanup(func() {
+		_ = l.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *dotServer) url() string {
+	return "tls://" + s.listener.Addr().String()
+}
+
+func answerA(t *testing.T, q dnsmessage.Message) []byte {
+	return packResponse(t, dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: q.ID, RecursionDesired: true, RecursionAvailable: true},
+		Questions: q.Questions,
+		Answers: []dnsmessage.Resource{{
+			Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+		}},
+	})
+}
+
+func TestParseProviderURLDoT(t *testing.T) {
+	p, err := ParseProviderURL("tls://1.1.1.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Protocol != ProtocolDoT {
+		t.Fatalf("expected dot protocol, got %q", p.Protocol)
+	}
+	if _, err := ParseProviderURL("tls://"); err == nil || !strings.Contains(err.Error(), "missing host") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = Provider{URL: "https://dns.example", Protocol: ProtocolDoT}.Validate()
+	if err == nil || !strings.Contains(err.Error(), "scheme must be tls") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClientDoTReusesConnection(t *testing.T) {
+	srv := newDoTServer(t, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.url(), Protocol: ProtocolDoT, ServerName: "example.com"}),
+		WithTLSConfig(&tls.Config{RootCAs: srv.roots}))
+	defer func() {
+		_ = client.Close()
+	}()
+
+	for range 3 {
+		output, err := client.Query(context.Background(), "example.com", "A")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(output.Records) != 1 || output.Records[0].Data != "192.0.2.1" {
+			t.Fatalf("unexpected records: %+v", output.Records)
+		}
+	}
+	if n := srv.accepted.Load(); n != 1 {
+		t.Fatalf("expected a single reused connection, got %d", n)
+	}
+	if _, ok := srv.serverNames.Load("example.com"); !ok {
+		t.Fatal("expected SNI example.com")
+	}
+}
+
+func TestClientDoTRedialsClosedConnection(t *testing.T) {
+	srv := newDoTServer(t, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.url(), Protocol: ProtocolDoT}),
+		WithTLSConfig(&tls.Config{RootCAs: srv.roots}))
+
+	if _, err := client.Query(context.Background(), "example.com", "A"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Close the pooled connection behind the client's back.
+	for _, conn := range client.conns.idle {
+		_ = conn.Close()
+	}
+	if _, err := client.Query(context.Background(), "example.com", "A"); err != nil {
+		t.Fatalf("expected the client to redial, got %v", err)
+	}
+	if n := srv.accepted.Load(); n != 2 {
+		t.Fatalf("expected 2 connections, got %d", n)
+	}
+	_ = client.Close()
+}
+
+func TestClientDoTVerifiesCertificate(t *testing.T) {
+	srv := newDoTServer(t, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.url(), Protocol: ProtocolDoT, ServerName: "dns.example.net"}),
+		WithTLSConfig(&tls.Config{RootCAs: srv.roots}))
+
+	_, err := client.Query(context.Background(), "example.com", "A")
+	var certErr *tls.CertificateVerificationError
+	if !errors.As(err, &certErr) {
+		t.Fatalf("expected certificate verification error, got %v", err)
+	}
+}
+
+func TestDoFormatDoTRcodeError(t *testing.T) {
+	srv := newDoTServer(t, func(t *testing.T, q dnsmessage.Message) []byte {
+		return packResponse(t, dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, RCode: dnsmessage.RCodeNameError},
+			Questions: q.Questions,
+		})
+	})
+
+	var err error
+	_ = captureStdout(t, func() {
+		err = DoFormat("a", "missing.example.com", false, FormatJSON, DefaultProvider,
+			WithProvider(Provider{URL: srv.url(), Protocol: ProtocolDoT}), WithTLSConfig(&tls.Config{RootCAs: srv.roots}))
+	})
+	var rcodeErr RcodeError
+	if !errors.As(err, &rcodeErr) || rcodeErr.Code != 3 {
+		t.Fatalf("expected NXDOMAIN RcodeError, got %v", err)
+	}
+}
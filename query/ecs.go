@@ -0,0 +1,117 @@
+package query
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ednsClientSubnetCode is the EDNS option code of Client Subnet (RFC 7871).
+const ednsClientSubnetCode = 8
+
+// ClientSubnet is the EDNS Client Subnet echoed by the server. ScopePrefix
+// is the prefix length the answer is valid for; zero means the answer does
+// not depend on the client network.
+type ClientSubnet struct {
+	Address      string `json:"address"`
+	SourcePrefix int    `json:"source_prefix"`
+	ScopePrefix  int    `json:"scope_prefix"`
+}
+
+func (s ClientSubnet) String() string {
+	return fmt.Sprintf("%s/%d scope /%d", s.Address, s.SourcePrefix, s.ScopePrefix)
+}
+
+// ParseClientSubnet parses an --ecs value. It accepts a prefix such as
+// 203.0.113.0/24 or a bare address, which is sent as a full-length prefix.
+// Host bits are cleared.
+func ParseClientSubnet(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid client subnet %q", s)
+		}
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid client subnet %q", s)
+	}
+	return prefix.Masked(), nil
+}
+
+// clientSubnetOption encodes prefix as an EDNS Client Subnet option with
+// the address truncated to the source prefix length (RFC 7871 section 6).
+func clientSubnetOption(prefix netip.Prefix) dnsmessage.Option {
+	family := uint16(1)
+	if prefix.Addr().Is6() {
+		family = 2
+	}
+	bits := prefix.Bits()
+	data := binary.BigEndian.AppendUint16(nil, family)
+	data = append(data, byte(bits), 0)
+	data = append(data, prefix.Masked().Addr().AsSlice()[:(bits+7)/8]...)
+	return dnsmessage.Option{Code: ednsClientSubnetCode, Data: data}
+}
+
+// responseClientSubnet returns the Client Subnet option in options in the
+// "address/source/scope" form of the JSON APIs, or "" when there is none.
+func responseClientSubnet(options []dnsmessage.Option) string {
+	for _, o := range options {
+		if o.Code != ednsClientSubnetCode {
+			continue
+		}
+		r := rdataReader{data: o.Data}
+		family := r.uint16()
+		source := r.uint8()
+		scope := r.uint8()
+		addr := r.rest()
+		if r.err != nil {
+			return ""
+		}
+		var ip netip.Addr
+		switch family {
+		case 1:
+			var b [4]byte
+			copy(b[:], addr)
+			ip = netip.AddrFrom4(b)
+		case 2:
+			var b [16]byte
+			copy(b[:], addr)
+			ip = netip.AddrFrom16(b)
+		default:
+			return ""
+		}
+		return fmt.Sprintf("%s/%d/%d", ip, source, scope)
+	}
+	return ""
+}
+
+// parseClientSubnet parses the edns_client_subnet value of a response,
+// either "address/source/scope" or "address/source". It returns nil when
+// the value is empty or malformed.
+func parseClientSubnet(s string) *ClientSubnet {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil
+	}
+	addr, err := netip.ParseAddr(parts[0])
+	if err != nil {
+		return nil
+	}
+	source, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil
+	}
+	subnet := &ClientSubnet{Address: addr.String(), SourcePrefix: source}
+	if len(parts) == 3 {
+		if subnet.ScopePrefix, err = strconv.Atoi(parts[2]); err != nil {
+			return nil
+		}
+	}
+	return subnet
+}
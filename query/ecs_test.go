@@ -0,0 +1,132 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseClientSubnet(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"203.0.113.0/24", "203.0.113.0/24"},
+		{"203.0.113.77/24", "203.0.113.0/24"},
+		{"198.51.100.1", "198.51.100.1/32"},
+		{"2001:db8::/56", "2001:db8::/56"},
+		{"0.0.0.0/0", "0.0.0.0/0"},
+	}
+	for _, tt := range tests {
+		got, err := ParseClientSubnet(tt.in)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("ParseClientSubnet(%q) = %v, %v; want %s", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "example.com", "203.0.113.0/33"} {
+		if _, err := ParseClientSubnet(in); err == nil {
+			t.Errorf("ParseClientSubnet(%q): expected error", in)
+		}
+	}
+}
+
+func TestClientSubnetOption(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   []byte
+	}{
+		{"203.0.113.0/24", []byte{0, 1, 24, 0, 203, 0, 113}},
+		{"203.0.113.0/20", []byte{0, 1, 20, 0, 203, 0, 112}},
+		{"2001:db8::/32", []byte{0, 2, 32, 0, 0x20, 0x01, 0x0d, 0xb8}},
+		{"0.0.0.0/0", []byte{0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		o := clientSubnetOption(netip.MustParsePrefix(tt.prefix))
+		if o.Code != ednsClientSubnetCode || !bytes.Equal(o.Data, tt.want) {
+			t.Errorf("clientSubnetOption(%s) = %v, want %v", tt.prefix, o.Data, tt.want)
+		}
+	}
+}
+
+func TestParseClientSubnetResponse(t *testing.T) {
+	if got := parseClientSubnet("203.0.113.0/24/16"); got == nil || *got != (ClientSubnet{"203.0.113.0", 24, 16}) {
+		t.Fatalf("unexpected subnet: %+v", got)
+	}
+	if got := parseClientSubnet("2001:db8::/56"); got == nil || *got != (ClientSubnet{"2001:db8::", 56, 0}) {
+		t.Fatalf("unexpected subnet: %+v", got)
+	}
+	for _, in := range []string{"", "203.0.113.0", "bogus/24", "203.0.113.0/x/0"} {
+		if got := parseClientSubnet(in); got != nil {
+			t.Errorf("parseClientSubnet(%q) = %+v, want nil", in, got)
+		}
+	}
+}
+
+func TestClientSubnetJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.URL.Query().Get("edns_client_subnet"), "203.0.113.0/24"; got != want {
+			t.Errorf("unexpected edns_client_subnet; got %q, want %q", got, want)
+		}
+		w.Header().Set("Content-Type", "application/dns-json")
+		_, _ = w.Write([]byte(`{"Status":0,"edns_client_subnet":"203.0.113.0/24/16"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProviderURL(srv.URL), WithClientSubnet(netip.MustParsePrefix("203.0.113.9/24")))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.ClientSubnet == nil || output.ClientSubnet.ScopePrefix != 16 {
+		t.Fatalf("unexpected client subnet: %+v", output.ClientSubnet)
+	}
+}
+
+func TestClientSubnetWire(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		var option *dnsmessage.Option
+		for _, r := range q.Additionals {
+			if opt, ok := r.Body.(*dnsmessage.OPTResource); ok {
+				for i := range opt.Options {
+					if opt.Options[i].Code == ednsClientSubnetCode {
+						option = &opt.Options[i]
+					}
+				}
+			}
+		}
+		if option == nil || !bytes.Equal(option.Data, []byte{0, 1, 24, 0, 203, 0, 113}) {
+			t.Errorf("unexpected client subnet option: %+v", option)
+		}
+
+		var opt dnsmessage.Resource
+		if err := opt.Header.SetEDNS0(1232, dnsmessage.RCodeSuccess, false); err != nil {
+			t.Fatalf("failed to set EDNS0: %v", err)
+		}
+		opt.Body = &dnsmessage.OPTResource{Options: []dnsmessage.Option{
+			{Code: ednsClientSubnetCode, Data: []byte{0, 1, 24, 16, 203, 0, 113}},
+		}}
+		return packResponse(t, dnsmessage.Message{
+			Header:      dnsmessage.Header{ID: q.ID},
+			Questions:   q.Questions,
+			Additionals: []dnsmessage.Resource{opt},
+		})
+	})
+
+	client := NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire, Method: http.MethodGet}),
+		WithClientSubnet(netip.MustParsePrefix("203.0.113.0/24")))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := output.ClientSubnet; got == nil || *got != (ClientSubnet{"203.0.113.0", 24, 16}) {
+		t.Fatalf("unexpected client subnet: %+v", got)
+	}
+	if got, want := output.ClientSubnet.String(), "203.0.113.0/24 scope /16"; got != want {
+		t.Fatalf("unexpected text; got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,337 @@
+package query
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"go.yaml.in/yaml/v3"
+)
+
+// QueryOutput is a response labelled with the query that produced it. The
+// labels are empty for a single query and set for multi-type queries.
+type QueryOutput struct {
+	QueryType string `json:"query_type,omitempty"`
+	QueryName string `json:"query_name,omitempty"`
+	JSONOutput
+}
+
+// Formatter prints DNS responses to standard output. It receives a single
+// unlabelled response for a plain query and one labelled response per type
+// for multi-type queries.
+type Formatter func(outputs []QueryOutput) error
+
+// Output formats
+const (
+	FormatText     = "text"
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatYAML     = "yaml"
+	FormatCSV      = "csv"
+	FormatTable    = "table"
+	FormatMarkdown = "markdown"
+	FormatDig      = "dig"
+	FormatShort    = "short"
+)
+
+var formatters = map[string]Formatter{
+	FormatText:     formatText,
+	FormatJSON:     formatJSON,
+	FormatNDJSON:   formatNDJSON,
+	FormatYAML:     formatYAML,
+	FormatCSV:      formatCSV,
+	FormatTable:    formatTable,
+	FormatMarkdown: formatMarkdown,
+	FormatDig:      formatEach(outputDig, "\n"),
+	FormatShort:    formatEach(outputShort, ""),
+}
+
+// Formats returns the sorted names of all output formats.
+func Formats() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// timingFormats are the formats that include JSONOutput.Timing in their
+// output.
+var timingFormats = []string{FormatJSON, FormatNDJSON, FormatYAML}
+
+// GetFormatter returns the formatter of the output format name. Except for the
+// formats that carry it, the formatter also prints the Timing of verbose
+// queries to stderr.
+func GetFormatter(name string) (Formatter, error) {
+	f, ok := formatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format: %s (valid formats: %s)", name, strings.Join(Formats(), ", "))
+	}
+	if slices.Contains(timingFormats, name) {
+		return f, nil
+	}
+	return printingTiming(f), nil
+}
+
+// printingTiming returns a formatter that runs f and then writes the Timing
+// of every output to stderr, keeping it out of the formatted output.
+func printingTiming(f Formatter) Formatter {
+	return func(outputs []QueryOutput) error {
+		if err := f(outputs); err != nil {
+			return err
+		}
+		for _, out := range outputs {
+			if out.Timing == nil {
+				continue
+			}
+			if isLabelled(outputs) {
+				_, _ = fmt.Fprintf(os.Stderr, ";; %s %s\n", out.QueryType, out.QueryName)
+			}
+			printTiming(os.Stderr, out.Timing)
+		}
+		return nil
+	}
+}
+
+// OutputResponse prints a parsed DNS response in the given output format.
+func OutputResponse(output JSONOutput, format string) error {
+	f, err := GetFormatter(format)
+	if err != nil {
+		return err
+	}
+	return f([]QueryOutput{{JSONOutput: output}})
+}
+
+// isLabelled reports whether outputs come from a multi-type query.
+func isLabelled(outputs []QueryOutput) bool {
+	return len(outputs) != 1 || outputs[0].QueryType != ""
+}
+
+// formatEach applies a single-response printer to every output, printing
+// sep between them.
+func formatEach(print func(JSONOutput) error, sep string) Formatter {
+	return func(outputs []QueryOutput) error {
+		for i, out := range outputs {
+			if i > 0 && sep != "" {
+				fmt.Print(sep)
+			}
+			if err := print(out.JSONOutput); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func formatText(outputs []QueryOutput) error {
+	if !isLabelled(outputs) {
+		return outputText(outputs[0].JSONOutput)
+	}
+
+	blue := color.New(color.FgBlue).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	for i, out := range outputs {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(blue(fmt.Sprintf(";; %s %s", out.QueryType, out.QueryName)))
+		if out.StatusName != "" {
+			if err := outputText(out.JSONOutput); err != nil {
+				return err
+			}
+		}
+		if out.Error != "" {
+			fmt.Printf("%s: %v\n", red("error"), out.Error)
+		}
+	}
+	return nil
+}
+
+func formatJSON(outputs []QueryOutput) error {
+	if !isLabelled(outputs) {
+		return outputJSON(outputs[0].JSONOutput)
+	}
+	jsonBytes, err := json.MarshalIndent(outputs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json marshal error: %w", err)
+	}
+	fmt.Println(string(jsonBytes))
+	return nil
+}
+
+func formatNDJSON(outputs []QueryOutput) error {
+	for _, out := range outputs {
+		line, err := json.Marshal(out)
+		if err != nil {
+			return fmt.Errorf("json marshal error: %w", err)
+		}
+		fmt.Println(string(line))
+	}
+	return nil
+}
+
+// formatYAML converts the JSON rendering to YAML so both formats share the
+// same field names and order.
+func formatYAML(outputs []QueryOutput) error {
+	var v any = outputs
+	if !isLabelled(outputs) {
+		v = outputs[0].JSONOutput
+	}
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("json marshal error: %w", err)
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(jsonBytes, &node); err != nil {
+		return fmt.Errorf("yaml convert error: %w", err)
+	}
+	resetYAMLStyle(&node)
+	yamlBytes, err := yaml.Marshal(&node)
+	if err != nil {
+		return fmt.Errorf("yaml marshal error: %w", err)
+	}
+	fmt.Print(string(yamlBytes))
+	return nil
+}
+
+// resetYAMLStyle drops the JSON flow style so the document is emitted in
+// block style.
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+// recordRow is one record flattened for tabular formats.
+type recordRow struct {
+	queryType string
+	queryName string
+	status    string
+	section   string
+	record    DNSRecord
+	err       string
+}
+
+// recordRows flattens all sections of outputs. Queries without records
+// produce a single row carrying the status and error.
+func recordRows(outputs []QueryOutput) []recordRow {
+	var rows []recordRow
+	for _, out := range outputs {
+		queryType, queryName := out.QueryType, out.QueryName
+		if queryType == "" && len(out.Question) > 0 {
+			queryType, queryName = out.Question[0].TypeName, out.Question[0].Name
+		}
+		base := recordRow{queryType: queryType, queryName: queryName, status: out.StatusName, err: out.Error}
+
+		n := len(rows)
+		for _, section := range []struct {
+			name    string
+			records []DNSRecord
+		}{
+			{"answer", out.Records},
+			{"authority", out.Authority},
+			{"additional", out.Additional},
+		} {
+			for _, r := range section.records {
+				row := base
+				row.section = section.name
+				row.record = r
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) == n {
+			rows = append(rows, base)
+		}
+	}
+	return rows
+}
+
+func formatCSV(outputs []QueryOutput) error {
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write([]string{"query_type", "query_name", "status", "section", "name", "type", "ttl", "data", "error"}); err != nil {
+		return err
+	}
+	for _, row := range recordRows(outputs) {
+		ttl := ""
+		if row.section != "" {
+			ttl = strconv.Itoa(row.record.TTL)
+		}
+		if err := w.Write([]string{row.queryType, row.queryName, row.status, row.section,
+			row.record.Name, row.record.TypeName, ttl, row.record.Data, row.err}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// tableCells returns the header and cells used by the table and markdown
+// formats. The query column is only shown for multi-type queries.
+func tableCells(outputs []QueryOutput) ([]string, [][]string) {
+	labelled := isLabelled(outputs)
+	header := []string{"SECTION", "NAME", "TTL", "TYPE", "DATA"}
+	if labelled {
+		header = append([]string{"QUERY"}, header...)
+	}
+
+	var cells [][]string
+	for _, row := range recordRows(outputs) {
+		var line []string
+		if row.section == "" {
+			data := row.status
+			if row.err != "" {
+				data = "error: " + row.err
+			}
+			line = []string{"-", "", "", "", data}
+		} else {
+			r := row.record
+			line = []string{row.section, r.Name, strconv.Itoa(r.TTL), r.TypeName, r.Data}
+		}
+		if labelled {
+			line = append([]string{row.queryType}, line...)
+		}
+		cells = append(cells, line)
+	}
+	return header, cells
+}
+
+func formatTable(outputs []QueryOutput) error {
+	header, cells := tableCells(outputs)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+		return err
+	}
+	for _, line := range cells {
+		if _, err := fmt.Fprintln(w, strings.Join(line, "\t")); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func formatMarkdown(outputs []QueryOutput) error {
+	header, cells := tableCells(outputs)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	fmt.Printf("| %s |\n", strings.Join(header, " | "))
+	fmt.Printf("| %s |\n", strings.Join(separator, " | "))
+	for _, line := range cells {
+		escaped := make([]string, len(line))
+		for i, cell := range line {
+			escaped[i] = strings.ReplaceAll(cell, "|", `\|`)
+		}
+		fmt.Printf("| %s |\n", strings.Join(escaped, " | "))
+	}
+	return nil
+}
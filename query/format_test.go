@@ -0,0 +1,134 @@
+package query
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func formatTestOutput() JSONOutput {
+	return JSONOutput{
+		Status:     0,
+		StatusName: "NOERROR",
+		Flags:      DNSFlags{RecursionDesired: true, RecursionAvailable: true},
+		Question:   []DNSQuestion{{Name: "example.com.", Type: 15, TypeName: "MX"}},
+		Records:    []DNSRecord{{Name: "example.com.", Type: 15, TypeName: "MX", TTL: 300, Data: "10 mail.example.com."}},
+		Additional: []DNSRecord{{Name: "mail.example.com.", Type: 1, TypeName: "A", TTL: 300, Data: "192.0.2.10"}},
+	}
+}
+
+func TestFormatsContainBuiltins(t *testing.T) {
+	formats := Formats()
+	for _, name := range []string{"text", "json", "ndjson", "yaml", "csv", "table", "markdown", "dig", "short"} {
+		if !slices.Contains(formats, name) {
+			t.Fatalf("expected format %q in %v", name, formats)
+		}
+	}
+	if _, err := GetFormatter("xml"); err == nil || !strings.Contains(err.Error(), "unknown output format: xml") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFormatYAML(t *testing.T) {
+	out := captureStdout(t, func() {
+		if err := OutputResponse(formatTestOutput(), FormatYAML); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	if !strings.HasPrefix(out, "status: 0\nstatus_name: NOERROR\n") {
+		t.Fatalf("expected JSON field names in JSON order, got:\n%s", out)
+	}
+	var got map[string]any
+	if err := yaml.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("expected valid yaml, got %q: %v", out, err)
+	}
+	if records, ok := got["records"].([]any); !ok || len(records) != 1 {
+		t.Fatalf("unexpected records in yaml: %v", got["records"])
+	}
+	if !strings.Contains(out, "data: 10 mail.example.com.") || strings.Contains(out, "{") {
+		t.Fatalf("expected block style yaml, got:\n%s", out)
+	}
+}
+
+func TestFormatNDJSON(t *testing.T) {
+	outputs := []QueryOutput{
+		{QueryType: "MX", QueryName: "example.com", JSONOutput: formatTestOutput()},
+		{QueryType: "TXT", QueryName: "example.com", JSONOutput: JSONOutput{Error: "request do error: timeout"}},
+	}
+	out := captureStdout(t, func() {
+		if err := formatNDJSON(outputs); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out)
+	}
+	var first QueryOutput
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.QueryType != "MX" || len(first.Records) != 1 {
+		t.Fatalf("unexpected first line %q: %v", lines[0], err)
+	}
+}
+
+func TestFormatCSV(t *testing.T) {
+	out := captureStdout(t, func() {
+		if err := OutputResponse(formatTestOutput(), FormatCSV); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	want := "query_type,query_name,status,section,name,type,ttl,data,error\n" +
+		"MX,example.com.,NOERROR,answer,example.com.,MX,300,10 mail.example.com.,\n" +
+		"MX,example.com.,NOERROR,additional,mail.example.com.,A,300,192.0.2.10,\n"
+	if out != want {
+		t.Fatalf("unexpected csv output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestFormatTable(t *testing.T) {
+	out := captureStdout(t, func() {
+		if err := OutputResponse(formatTestOutput(), FormatTable); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	want := "SECTION     NAME               TTL  TYPE  DATA\n" +
+		"answer      example.com.       300  MX    10 mail.example.com.\n" +
+		"additional  mail.example.com.  300  A     192.0.2.10\n"
+	if out != want {
+		t.Fatalf("unexpected table output:\n%s\nwant:\n%s", out, want)
+	}
+}
+
+func TestFormatMarkdownMultiType(t *testing.T) {
+	outputs := []QueryOutput{
+		{QueryType: "MX", QueryName: "example.com", JSONOutput: JSONOutput{
+			StatusName: "NOERROR",
+			Records:    []DNSRecord{{Name: "example.com.", TypeName: "MX", TTL: 300, Data: "10 mail.example.com."}},
+		}},
+		{QueryType: "TXT", QueryName: "example.com", JSONOutput: JSONOutput{
+			StatusName: "NOERROR",
+			Records:    []DNSRecord{{Name: "example.com.", TypeName: "TXT", TTL: 60, Data: `"a|b"`}},
+		}},
+		{QueryType: "CAA", QueryName: "example.com", JSONOutput: JSONOutput{Error: "request do error: timeout"}},
+	}
+	out := captureStdout(t, func() {
+		if err := formatMarkdown(outputs); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	want := "| QUERY | SECTION | NAME | TTL | TYPE | DATA |\n" +
+		"| --- | --- | --- | --- | --- | --- |\n" +
+		"| MX | answer | example.com. | 300 | MX | 10 mail.example.com. |\n" +
+		`| TXT | answer | example.com. | 60 | TXT | "a\|b" |` + "\n" +
+		"| CAA | - |  |  |  | error: request do error: timeout |\n"
+	if out != want {
+		t.Fatalf("unexpected markdown output:\n%s\nwant:\n%s", out, want)
+	}
+}
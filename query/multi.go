@@ -0,0 +1,100 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Query type presets accepted in place of a type list
+var typePresets = map[string][]string{
+	"ALL": {"A", "AAAA", "CNAME", "MX", "NS", "SOA", "TXT", "CAA", "HTTPS", "SRV"},
+}
+
+// IsMultiType reports whether queryType names more than a single type,
+// i.e. it is a comma separated list or a preset such as "all".
+func IsMultiType(queryType string) bool {
+	_, preset := typePresets[strings.ToUpper(queryType)]
+	return preset || strings.Contains(queryType, ",")
+}
+
+// ExpandQueryTypes turns a comma separated type list, which may contain
+// presets, into upper-case type names without duplicates.
+func ExpandQueryTypes(queryType string) ([]string, error) {
+	var types []string
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(queryType, ",") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		expanded, ok := typePresets[part]
+		if !ok {
+			if _, err := parseDNSType(part); err != nil {
+				return nil, err
+			}
+			expanded = []string{part}
+		}
+		for _, t := range expanded {
+			if !seen[t] {
+				seen[t] = true
+				types = append(types, t)
+			}
+		}
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("no query type given")
+	}
+	return types, nil
+}
+
+// QueryTypes resolves name for every type in parallel and returns the
+// results in the order of types.
+func (c *Client) QueryTypes(ctx context.Context, name string, types []string) []BatchResult {
+	queries := make([]BatchQuery, len(types))
+	for i, t := range types {
+		queries[i] = BatchQuery{Type: t, Name: name}
+	}
+	results := make([]BatchResult, 0, len(types))
+	_ = c.Batch(ctx, queries, len(queries), true, func(res BatchResult) error {
+		results = append(results, res)
+		return nil
+	})
+	return results
+}
+
+// doMulti resolves several types for domain and prints the results grouped
+// by type. Per-type errors are reported inline; an error is only returned
+// when every query failed without a DNS response.
+func doMulti(client *Client, queryType, domain string, formatter Formatter) error {
+	types, err := ExpandQueryTypes(queryType)
+	if err != nil {
+		return err
+	}
+
+	results := client.QueryTypes(context.Background(), domain, types)
+	outputs := make([]QueryOutput, 0, len(results))
+	var firstErr error
+	answered := 0
+	for _, res := range results {
+		out := QueryOutput{QueryType: res.Query.Type, QueryName: res.Query.Name}
+		if res.Output != nil {
+			out.JSONOutput = *res.Output
+		}
+		var rcodeErr RcodeError
+		if res.Err == nil || errors.As(res.Err, &rcodeErr) {
+			answered++
+		} else if firstErr == nil {
+			firstErr = res.Err
+		}
+		if res.Err != nil {
+			out.Error = res.Err.Error()
+		}
+		outputs = append(outputs, out)
+	}
+	if answered == 0 {
+		return firstErr
+	}
+	return formatter(outputs)
+}
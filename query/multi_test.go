@@ -0,0 +1,128 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExpandQueryTypes(t *testing.T) {
+	got, err := ExpandQueryTypes("a, aaaa,mx,A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"A", "AAAA", "MX"}; !slices.Equal(got, want) {
+		t.Fatalf("unexpected types; got %v, want %v", got, want)
+	}
+
+	all, err := ExpandQueryTypes("all,ptr")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Contains(all, "HTTPS") || all[len(all)-1] != "PTR" {
+		t.Fatalf("unexpected preset expansion: %v", all)
+	}
+
+	if _, err := ExpandQueryTypes("a,bogus"); err == nil || !strings.Contains(err.Error(), "unknown query type: BOGUS") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ExpandQueryTypes(","); err == nil {
+		t.Fatal("expected error for empty type list")
+	}
+}
+
+func TestIsMultiType(t *testing.T) {
+	for in, want := range map[string]bool{"a": false, "HTTPS": false, "a,mx": true, "all": true, "ALL": true} {
+		if got := IsMultiType(in); got != want {
+			t.Fatalf("IsMultiType(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func newMultiTypeServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("type") {
+		case "A":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":60,"data":"192.0.2.1"}]}`))
+		case "MX":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":15,"TTL":60,"data":"10 mail.example.com."}]}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDoMultipleTypesJSON(t *testing.T) {
+	srv := newMultiTypeServer(t)
+
+	out := captureStdout(t, func() {
+		if err := Do("a,mx,txt", "example.com", false, true, DefaultProvider, WithProviderURL(srv.URL)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	var got []struct {
+		QueryType string `json:"query_type"`
+		JSONOutput
+	}
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("expected JSON array, got %q: %v", out, err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(got))
+	}
+	if got[0].QueryType != "A" || got[0].Records[0].Data != "192.0.2.1" {
+		t.Fatalf("unexpected A result: %+v", got[0])
+	}
+	if got[1].QueryType != "MX" || got[1].Records[0].Data != "10 mail.example.com." {
+		t.Fatalf("unexpected MX result: %+v", got[1])
+	}
+	if got[2].QueryType != "TXT" || !strings.Contains(got[2].Error, "502") {
+		t.Fatalf("expected TXT error, got %+v", got[2])
+	}
+}
+
+func TestDoMultipleTypesText(t *testing.T) {
+	srv := newMultiTypeServer(t)
+
+	out := captureStdout(t, func() {
+		if err := Do("a,mx", "example.com", false, false, DefaultProvider, WithProviderURL(srv.URL)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	aIdx := strings.Index(out, ";; A example.com")
+	mxIdx := strings.Index(out, ";; MX example.com")
+	if aIdx < 0 || mxIdx < aIdx {
+		t.Fatalf("expected grouped output in type order: %s", out)
+	}
+	if !strings.Contains(out[aIdx:mxIdx], "data: 192.0.2.1") || !strings.Contains(out[mxIdx:], "data: 10 mail.example.com.") {
+		t.Fatalf("records not grouped under their type: %s", out)
+	}
+}
+
+func TestDoMultipleTypesAllFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprint(w, "down")
+	}))
+	defer srv.Close()
+
+	out := captureStdout(t, func() {
+		err := Do("a,aaaa", "example.com", false, true, DefaultProvider, WithProviderURL(srv.URL))
+		if err == nil || !strings.Contains(err.Error(), "error response status") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if out != "" {
+		t.Fatalf("expected nothing printed when every query failed, got %q", out)
+	}
+}
@@ -0,0 +1,336 @@
+package query
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+)
+
+// cnameType is the CNAME record type.
+const cnameType = 5
+
+// maxNSEC3Iterations is the largest NSEC3 iteration count that is hashed.
+// Proofs with more iterations are treated as insecure instead, so that a
+// response cannot make the client hash thousands of times per record
+// (RFC 9276 section 3.2).
+const maxNSEC3Iterations = 100
+
+// errNSEC3Iterations reports NSEC3 records above maxNSEC3Iterations.
+var errNSEC3Iterations = fmt.Errorf("NSEC3 iterations above %d", maxNSEC3Iterations)
+
+// nsecRecord is a decoded NSEC record.
+type nsecRecord struct {
+	owner []byte
+	next  []byte
+	types []byte
+}
+
+// nsec3Record is a decoded NSEC3 record. hash is the hashed owner name
+// taken from the first label of the owner.
+type nsec3Record struct {
+	hash          []byte
+	hashAlgorithm uint8
+	flags         uint8
+	iterations    uint16
+	salt          []byte
+	next          []byte
+	types         []byte
+}
+
+// denialRecords are the verified NSEC and NSEC3 records of a response.
+type denialRecords struct {
+	nsec  []nsecRecord
+	nsec3 []nsec3Record
+}
+
+// add decodes an NSEC or NSEC3 record and adds it to d.
+func (d *denialRecords) add(rr dnssecRR) error {
+	r := rdataReader{data: rr.rdata}
+	switch rr.rrtype {
+	case nsecType:
+		n := nsecRecord{owner: rr.name, next: bytes.ToLower(r.wireName()), types: r.rest()}
+		if r.err != nil {
+			return fmt.Errorf("invalid NSEC record: %w", r.err)
+		}
+		d.nsec = append(d.nsec, n)
+	case nsec3Type:
+		n := nsec3Record{hashAlgorithm: r.uint8(), flags: r.uint8(), iterations: r.uint16()}
+		n.salt = r.bytes(int(r.uint8()))
+		n.next = r.bytes(int(r.uint8()))
+		n.types = r.rest()
+		labels := nameLabels(rr.name)
+		if r.err != nil || len(labels) == 0 {
+			return errors.New("invalid NSEC3 record")
+		}
+		hash, err := base32HexNoPad.DecodeString(string(bytes.ToUpper(labels[0])))
+		if err != nil {
+			return fmt.Errorf("invalid NSEC3 owner: %w", err)
+		}
+		n.hash = hash
+		d.nsec3 = append(d.nsec3, n)
+	}
+	return nil
+}
+
+// kind names the denial records for reports.
+func (d denialRecords) kind() string {
+	if len(d.nsec3) > 0 {
+		return "NSEC3"
+	}
+	return "NSEC"
+}
+
+// proveNoData checks that name exists but has no records of qtype, either
+// directly or through a wildcard.
+func (d denialRecords) proveNoData(name []byte, qtype uint16) error {
+	if len(d.nsec) > 0 {
+		for _, n := range d.nsec {
+			if bytes.Equal(n.owner, name) {
+				return checkTypeAbsent(n.types, qtype)
+			}
+		}
+		ce, err := d.nsecClosestEncloser(name)
+		if err != nil {
+			return err
+		}
+		wildcard := append([]byte{1, '*'}, ce...)
+		for _, n := range d.nsec {
+			if bytes.Equal(n.owner, wildcard) {
+				return checkTypeAbsent(n.types, qtype)
+			}
+		}
+		return fmt.Errorf("no NSEC record for %s", nameString(name))
+	}
+
+	if n := d.nsec3Matching(name); n != nil {
+		return checkTypeAbsent(n.types, qtype)
+	}
+	ce, _, err := d.nsec3ClosestEncloser(name)
+	if err != nil {
+		return err
+	}
+	if n := d.nsec3Matching(append([]byte{1, '*'}, ce...)); n != nil {
+		return checkTypeAbsent(n.types, qtype)
+	}
+	return fmt.Errorf("no NSEC3 record for %s", nameString(name))
+}
+
+// proveNXDomain checks that neither name nor a wildcard that could expand
+// to it exists.
+func (d denialRecords) proveNXDomain(name []byte) error {
+	if len(d.nsec) > 0 {
+		ce, err := d.nsecClosestEncloser(name)
+		if err != nil {
+			return err
+		}
+		if !d.nsecCovers(append([]byte{1, '*'}, ce...)) {
+			return fmt.Errorf("no NSEC record denies the wildcard at %s", nameString(ce))
+		}
+		return nil
+	}
+
+	ce, _, err := d.nsec3ClosestEncloser(name)
+	if err != nil {
+		return err
+	}
+	if d.nsec3Covering(append([]byte{1, '*'}, ce...)) == nil {
+		return fmt.Errorf("no NSEC3 record denies the wildcard at %s", nameString(ce))
+	}
+	return nil
+}
+
+// proveNoDS checks that the delegation to zone has no DS records, making
+// the zone insecure (RFC 4035 section 5.2, RFC 5155 section 8.6).
+func (d denialRecords) proveNoDS(zone []byte) error {
+	if len(d.nsec) > 0 {
+		for _, n := range d.nsec {
+			if bytes.Equal(n.owner, zone) {
+				return checkDelegation(n.types)
+			}
+		}
+		return fmt.Errorf("no NSEC record for %s", nameString(zone))
+	}
+
+	if n := d.nsec3Matching(zone); n != nil {
+		return checkDelegation(n.types)
+	}
+	_, optOut, err := d.nsec3ClosestEncloser(zone)
+	if err != nil {
+		return err
+	}
+	if !optOut {
+		return fmt.Errorf("NSEC3 record covering %s does not have the opt-out flag", nameString(zone))
+	}
+	return nil
+}
+
+// proveWildcard checks that an answer synthesized from a wildcard with the
+// given number of labels was not available as an exact match
+// (RFC 4035 section 5.3.4).
+func (d denialRecords) proveWildcard(name []byte, labels int) error {
+	if len(d.nsec) > 0 {
+		if !d.nsecCovers(name) {
+			return fmt.Errorf("no NSEC record denies %s", nameString(name))
+		}
+		return nil
+	}
+	nextCloser := ancestorName(name, labels+1)
+	if d.nsec3Covering(nextCloser) == nil {
+		return fmt.Errorf("no NSEC3 record denies %s", nameString(nextCloser))
+	}
+	return nil
+}
+
+func (d denialRecords) nsecCovers(name []byte) bool {
+	for _, n := range d.nsec {
+		if coversName(n.owner, n.next, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// nsecClosestEncloser finds the NSEC record covering name and returns the
+// closest encloser it proves: the longest ancestor of name shared with the
+// owner or next name of the record.
+func (d denialRecords) nsecClosestEncloser(name []byte) ([]byte, error) {
+	for _, n := range d.nsec {
+		if !coversName(n.owner, n.next, name) {
+			continue
+		}
+		ce := commonAncestor(name, n.owner)
+		if other := commonAncestor(name, n.next); len(nameLabels(other)) > len(nameLabels(ce)) {
+			ce = other
+		}
+		return ce, nil
+	}
+	return nil, fmt.Errorf("no NSEC record denies %s", nameString(name))
+}
+
+// coversName reports whether name sorts strictly between owner and next,
+// taking the wrap-around of the last NSEC record in a zone into account.
+func coversName(owner, next, name []byte) bool {
+	if compareNames(owner, next) < 0 {
+		return compareNames(owner, name) < 0 && compareNames(name, next) < 0
+	}
+	return compareNames(owner, name) < 0 || compareNames(name, next) < 0
+}
+
+func commonAncestor(a, b []byte) []byte {
+	for n := min(len(nameLabels(a)), len(nameLabels(b))); n > 0; n-- {
+		if x := ancestorName(a, n); bytes.Equal(x, ancestorName(b, n)) {
+			return x
+		}
+	}
+	return []byte{0}
+}
+
+func (d denialRecords) nsec3Matching(name []byte) *nsec3Record {
+	for i, n := range d.nsec3 {
+		if n.hashAlgorithm == nsec3SHA1 && n.iterations <= maxNSEC3Iterations && bytes.Equal(n.hash, nsec3Hash(name, n.salt, n.iterations)) {
+			return &d.nsec3[i]
+		}
+	}
+	return nil
+}
+
+func (d denialRecords) nsec3Covering(name []byte) *nsec3Record {
+	for i, n := range d.nsec3 {
+		if n.hashAlgorithm != nsec3SHA1 || n.iterations > maxNSEC3Iterations {
+			continue
+		}
+		h := nsec3Hash(name, n.salt, n.iterations)
+		if bytes.Compare(n.hash, n.next) < 0 {
+			if bytes.Compare(n.hash, h) < 0 && bytes.Compare(h, n.next) < 0 {
+				return &d.nsec3[i]
+			}
+		} else if bytes.Compare(n.hash, h) < 0 || bytes.Compare(h, n.next) < 0 {
+			return &d.nsec3[i]
+		}
+	}
+	return nil
+}
+
+// nsec3ClosestEncloser runs the closest encloser proof of RFC 5155 section
+// 8.3. It returns the closest encloser and whether the record covering the
+// next closer name has the opt-out flag.
+func (d denialRecords) nsec3ClosestEncloser(name []byte) ([]byte, bool, error) {
+	for ce := parentName(name); ; ce = parentName(ce) {
+		if d.nsec3Matching(ce) != nil {
+			nextCloser := ancestorName(name, len(nameLabels(ce))+1)
+			cover := d.nsec3Covering(nextCloser)
+			if cover == nil {
+				return nil, false, fmt.Errorf("no NSEC3 record denies %s", nameString(nextCloser))
+			}
+			return ce, cover.flags&nsec3OptOut != 0, nil
+		}
+		if len(ce) <= 1 {
+			break
+		}
+	}
+	return nil, false, fmt.Errorf("no NSEC3 closest encloser proof for %s", nameString(name))
+}
+
+// nsec3Hash computes the iterated SHA-1 hash of a name (RFC 5155 section 5).
+func nsec3Hash(name, salt []byte, iterations uint16) []byte {
+	h := sha1.Sum(append(bytes.ToLower(name), salt...))
+	for range iterations {
+		h = sha1.Sum(append(h[:], salt...))
+	}
+	return h[:]
+}
+
+// checkTypeAbsent verifies that a type bit map has neither qtype nor a
+// CNAME that would have been followed instead. The record also has to come
+// from the zone that is authoritative for qtype: a parent-side record at a
+// delegation (NS without SOA) only proves the absence of DS, and a record
+// at a child apex cannot prove it (RFC 4035 section 5.4, RFC 5155 section
+// 8.6, RFC 6840 section 4.4).
+func checkTypeAbsent(bitmap []byte, qtype uint16) error {
+	if typeBitmapHas(bitmap, qtype) {
+		return fmt.Errorf("type bit map lists %s", dnsTypeName(int(qtype)))
+	}
+	if typeBitmapHas(bitmap, cnameType) {
+		return errors.New("type bit map lists CNAME")
+	}
+	delegation := typeBitmapHas(bitmap, 2) && !typeBitmapHas(bitmap, 6)
+	if qtype != dsType && delegation {
+		return errors.New("type bit map describes a delegation, not the child zone")
+	}
+	if qtype == dsType && typeBitmapHas(bitmap, 6) {
+		return errors.New("type bit map lists SOA of the child zone")
+	}
+	return nil
+}
+
+// checkDelegation verifies that a type bit map describes a delegation
+// without DS records.
+func checkDelegation(bitmap []byte) error {
+	switch {
+	case typeBitmapHas(bitmap, dsType):
+		return errors.New("type bit map lists DS")
+	case !typeBitmapHas(bitmap, 2):
+		return errors.New("type bit map does not list NS")
+	case typeBitmapHas(bitmap, 6):
+		return errors.New("type bit map lists SOA of the child zone")
+	}
+	return nil
+}
+
+// typeBitmapHas reports whether an NSEC/NSEC3 type bit map includes t.
+func typeBitmapHas(bitmap []byte, t uint16) bool {
+	for len(bitmap) >= 2 {
+		window, length := bitmap[0], int(bitmap[1])
+		bitmap = bitmap[2:]
+		if length > len(bitmap) {
+			return false
+		}
+		if uint16(window) == t>>8 {
+			i := int(t&0xFF) / 8
+			return i < length && bitmap[i]&(0x80>>(t%8)) != 0
+		}
+		bitmap = bitmap[length:]
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hpke"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Oblivious DNS over HTTPS (RFC 9230) constants
+const (
+	odohContentType     = "application/oblivious-dns-message"
+	odohConfigsPath     = "/.well-known/odohconfigs"
+	odohVersion         = 0x0001
+	odohMessageQuery    = 0x01
+	odohMessageResponse = 0x02
+	// odohPaddingBlock pads queries to a multiple of 128 bytes, the block
+	// size recommended for queries by RFC 8467.
+	odohPaddingBlock = 128
+)
+
+// odohKDFs maps HPKE KDF identifiers to the hash used for the response key
+// derivation.
+var odohKDFs = map[uint16]func() hash.Hash{
+	0x0001: sha256.New,    // HKDF-SHA256
+	0x0002: sha512.New384, // HKDF-SHA384
+	0x0003: sha512.New,    // HKDF-SHA512
+}
+
+// odohAEADs maps HPKE AEAD identifiers to the cipher used to encrypt
+// responses and its key size (Nk).
+var odohAEADs = map[uint16]struct {
+	newAEAD func(key []byte) (cipher.AEAD, error)
+	keySize int
+}{
+	0x0001: {newGCM, 16},                                     // AES-128-GCM
+	0x0002: {newGCM, 32},                                     // AES-256-GCM
+	0x0003: {chacha20poly1305.New, chacha20poly1305.KeySize}, // ChaCha20Poly1305
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// odohConfig is an ObliviousDoHConfigContents structure published by a
+// target (RFC 9230 section 6.1).
+type odohConfig struct {
+	kemID     uint16
+	kdfID     uint16
+	aeadID    uint16
+	publicKey []byte
+	// contents is the serialized structure the key ID is derived from.
+	contents []byte
+}
+
+// odohState caches the target configuration between queries.
+type odohState struct {
+	mu     sync.Mutex
+	config *odohConfig
+}
+
+// parseODoHConfigs decodes an ObliviousDoHConfigs structure and returns the
+// configurations with a supported version and cipher suite, in the target's
+// order of preference.
+func parseODoHConfigs(data []byte) ([]odohConfig, error) {
+	r := rdataReader{data: data}
+	list := rdataReader{data: r.bytes(int(r.uint16()))}
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid odoh configs: %w", r.err)
+	}
+
+	var configs []odohConfig
+	for list.err == nil && list.remaining() > 0 {
+		version := list.uint16()
+		contents := list.bytes(int(list.uint16()))
+		if list.err != nil || version != odohVersion {
+			continue
+		}
+		c := rdataReader{data: contents}
+		cfg := odohConfig{kemID: c.uint16(), kdfID: c.uint16(), aeadID: c.uint16(), contents: contents}
+		cfg.publicKey = c.bytes(int(c.uint16()))
+		if c.err != nil {
+			return nil, fmt.Errorf("invalid odoh config: %w", c.err)
+		}
+		if _, err := hpke.NewKEM(cfg.kemID); err != nil {
+			continue
+		}
+		if _, ok := odohKDFs[cfg.kdfID]; !ok {
+			continue
+		}
+		if _, ok := odohAEADs[cfg.aeadID]; !ok {
+			continue
+		}
+		configs = append(configs, cfg)
+	}
+	if list.err != nil {
+		return nil, fmt.Errorf("invalid odoh configs: %w", list.err)
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("no supported odoh config")
+	}
+	return configs, nil
+}
+
+// keyID derives the identifier of the target's public key (RFC 9230
+// section 6.2).
+func (cfg odohConfig) keyID() ([]byte, error) {
+	h := odohKDFs[cfg.kdfID]
+	prk, err := hkdf.Extract(h, cfg.contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	return hkdf.Expand(h, prk, "odoh key id", h().Size())
+}
+
+// odohConfig returns the target configuration, fetching it from the
+// well-known location on first use. The fetch goes through Provider.Proxy
+// like the queries, so the target never sees the client address.
+func (c *Client) odohConfig(ctx context.Context) (odohConfig, error) {
+	c.odoh.mu.Lock()
+	defer c.odoh.mu.Unlock()
+	if c.odoh.config != nil {
+		return *c.odoh.config, nil
+	}
+
+	target, err := url.Parse(c.provider.URL)
+	if err != nil {
+		return odohConfig{}, fmt.Errorf("invalid url: %w", err)
+	}
+	configsURL := url.URL{Scheme: target.Scheme, Host: target.Host, Path: odohConfigsPath}
+	endpoint, err := c.odohEndpoint(&configsURL)
+	if err != nil {
+		return odohConfig{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return odohConfig{}, fmt.Errorf("new request error: %w", err)
+	}
+	content, err := c.doRequest(req)
+	if err != nil {
+		return odohConfig{}, fmt.Errorf("fetch odoh configs: %w", err)
+	}
+	configs, err := parseODoHConfigs(content)
+	if err != nil {
+		return odohConfig{}, err
+	}
+	c.odoh.config = &configs[0]
+	return configs[0], nil
+}
+
+// queryODoH resolves domain through an Oblivious DoH target. The query is
+// encrypted to the target's public key and sent through Provider.Proxy, so
+// the proxy sees the client address but not the query, and the target sees
+// the query but not the client address.
+func (c *Client) queryODoH(ctx context.Context, domain, queryType string) ([]byte, error) {
+	msg, err := c.newWireQuery(domain, queryType)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := c.odohConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := odohPlaintext(msg)
+	sender, body, err := sealODoHQuery(cfg, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt query error: %w", err)
+	}
+
+	req, err := c.newODoHRequest(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	content, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := openODoHResponse(cfg, sender, plaintext, content)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt response error: %w", err)
+	}
+	return answer, nil
+}
+
+// newODoHRequest builds the POST request for the target, addressed through
+// the proxy when one is configured (RFC 9230 section 4.1).
+func (c *Client) newODoHRequest(ctx context.Context, body []byte) (*http.Request, error) {
+	target, err := url.Parse(c.provider.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+	endpoint, err := c.odohEndpoint(target)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("new request error: %w", err)
+	}
+	req.Header.Set("content-type", odohContentType)
+	req.Header.Set("accept", odohContentType)
+	return req, nil
+}
+
+// odohEndpoint returns the URL that reaches target: the target itself, or
+// Provider.Proxy with the targethost and targetpath parameters of RFC 9230
+// section 4.1 when a proxy is set.
+func (c *Client) odohEndpoint(target *url.URL) (string, error) {
+	if c.provider.Proxy == "" {
+		return target.String(), nil
+	}
+	proxy, err := url.Parse(c.provider.Proxy)
+	if err != nil {
+		return "", fmt.Errorf("invalid proxy url: %w", err)
+	}
+	params := proxy.Query()
+	params.Set("targethost", target.Host)
+	params.Set("targetpath", target.EscapedPath())
+	proxy.RawQuery = params.Encode()
+	return proxy.String(), nil
+}
+
+// odohPlaintext encodes an ObliviousDoHMessagePlaintext with the query
+// padded to a multiple of odohPaddingBlock bytes.
+func odohPlaintext(msg []byte) []byte {
+	padding := (odohPaddingBlock - (len(msg)+4)%odohPaddingBlock) % odohPaddingBlock
+	b := appendOpaque16(nil, msg)
+	return appendOpaque16(b, make([]byte, padding))
+}
+
+// sealODoHQuery encrypts plaintext to the target and returns the HPKE
+// context needed to decrypt the response along with the encoded
+// ObliviousDoHMessage.
+func sealODoHQuery(cfg odohConfig, plaintext []byte) (*hpke.Sender, []byte, error) {
+	kem, err := hpke.NewKEM(cfg.kemID)
+	if err != nil {
+		return nil, nil, err
+	}
+	pk, err := kem.NewPublicKey(cfg.publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	kdf, err := hpke.NewKDF(cfg.kdfID)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := hpke.NewAEAD(cfg.aeadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID, err := cfg.keyID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc, sender, err := hpke.NewSender(pk, kdf, aead, []byte("odoh query"))
+	if err != nil {
+		return nil, nil, err
+	}
+	aad := appendOpaque16([]byte{odohMessageQuery}, keyID)
+	ct, err := sender.Seal(aad, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sender, appendOpaque16(aad, append(enc, ct...)), nil
+}
+
+// openODoHResponse decrypts an ObliviousDoHMessage response and returns the
+// DNS message it carries (RFC 9230 section 6.4).
+func openODoHResponse(cfg odohConfig, sender *hpke.Sender, query, data []byte) ([]byte, error) {
+	r := rdataReader{data: data}
+	msgType := r.uint8()
+	nonce := r.bytes(int(r.uint16()))
+	ct := r.bytes(int(r.uint16()))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if msgType != odohMessageResponse {
+		return nil, fmt.Errorf("unexpected message type %d", msgType)
+	}
+
+	secret, err := sender.Export("odoh response", odohAEADs[cfg.aeadID].keySize)
+	if err != nil {
+		return nil, err
+	}
+	aead, iv, err := odohResponseAEAD(cfg, secret, query, nonce)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, iv, ct, appendOpaque16([]byte{odohMessageResponse}, nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	p := rdataReader{data: plaintext}
+	answer := p.bytes(int(p.uint16()))
+	if p.err != nil {
+		return nil, p.err
+	}
+	return answer, nil
+}
+
+// odohResponseAEAD derives the response key and nonce from the exported
+// HPKE secret, the query plaintext and the response nonce.
+func odohResponseAEAD(cfg odohConfig, secret, query, nonce []byte) (cipher.AEAD, []byte, error) {
+	suite := odohAEADs[cfg.aeadID]
+	h := odohKDFs[cfg.kdfID]
+	prk, err := hkdf.Extract(h, secret, appendOpaque16(bytes.Clone(query), nonce))
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := hkdf.Expand(h, prk, "odoh key", suite.keySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := suite.newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv, err := hkdf.Expand(h, prk, "odoh nonce", aead.NonceSize())
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, iv, nil
+}
+
+// appendOpaque16 appends b with a two-byte length prefix.
+func appendOpaque16(dst, b []byte) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(b)))
+	return append(dst, b...)
+}
@@ -0,0 +1,240 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/hpke"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// encodeODoHConfigs serializes configs as an ObliviousDoHConfigs structure.
+func encodeODoHConfigs(configs ...[]byte) []byte {
+	var list []byte
+	for _, contents := range configs {
+		list = binary.BigEndian.AppendUint16(list, odohVersion)
+		list = appendOpaque16(list, contents)
+	}
+	return appendOpaque16(nil, list)
+}
+
+func odohConfigContents(kemID, kdfID, aeadID uint16, publicKey []byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, kemID)
+	b = binary.BigEndian.AppendUint16(b, kdfID)
+	b = binary.BigEndian.AppendUint16(b, aeadID)
+	return appendOpaque16(b, publicKey)
+}
+
+// odohTarget is an in-process Oblivious DoH target using
+// DHKEM(X25519, HKDF-SHA256), HKDF-SHA256 and AES-128-GCM.
+type odohTarget struct {
+	srv            *httptest.Server
+	configRequests atomic.Int32
+}
+
+func newODoHTarget(t *testing.T, answer func(t *testing.T, q dnsmessage.Message) []byte) *odohTarget {
+	t.Helper()
+	priv, err := hpke.DHKEM(ecdh.X25519()).GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	contents := odohConfigContents(0x0020, 0x0001, 0x0001, priv.PublicKey().Bytes())
+	configs, err := parseODoHConfigs(encodeODoHConfigs(contents))
+	if err != nil {
+		t.Fatalf("failed to parse configs: %v", err)
+	}
+	cfg := configs[0]
+	keyID, err := cfg.keyID()
+	if err != nil {
+		t.Fatalf("failed to derive key id: %v", err)
+	}
+
+	target := &odohTarget{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+odohConfigsPath, func(w http.ResponseWriter, r *http.Request) {
+		target.configRequests.Add(1)
+		_, _ = w.Write(encodeODoHConfigs(contents))
+	})
+	mux.HandleFunc("POST /dns-query", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Content-Type"); got != odohContentType {
+			t.Errorf("unexpected Content-Type %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		m := rdataReader{data: body}
+		msgType := m.uint8()
+		gotKeyID := m.bytes(int(m.uint16()))
+		encrypted := m.bytes(int(m.uint16()))
+		if m.err != nil || msgType != odohMessageQuery || !bytes.Equal(gotKeyID, keyID) {
+			t.Errorf("unexpected odoh message: type %d, key id %x, err %v", msgType, gotKeyID, m.err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		kdf, _ := hpke.NewKDF(cfg.kdfID)
+		aead, _ := hpke.NewAEAD(cfg.aeadID)
+		recipient, err := hpke.NewRecipient(encrypted[:32], priv, kdf, aead, []byte("odoh query"))
+		if err != nil {
+			t.Errorf("failed to set up recipient: %v", err)
+			return
+		}
+		query, err := recipient.Open(appendOpaque16([]byte{odohMessageQuery}, keyID), encrypted[32:])
+		if err != nil {
+			t.Errorf("failed to decrypt query: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if len(query)%odohPaddingBlock != 0 {
+			t.Errorf("expected padded query, got %d bytes", len(query))
+		}
+		p := rdataReader{data: query}
+		var q dnsmessage.Message
+		if err := q.Unpack(p.bytes(int(p.uint16()))); err != nil {
+			t.Errorf("failed to unpack query: %v", err)
+			return
+		}
+
+		secret, _ := recipient.Export("odoh response", odohAEADs[cfg.aeadID].keySize)
+		nonce := make([]byte, max(12, odohAEADs[cfg.aeadID].keySize))
+		_, _ = rand.Read(nonce)
+		respAEAD, iv, err := odohResponseAEAD(cfg, secret, query, nonce)
+		if err != nil {
+			t.Errorf("failed to derive response key: %v", err)
+			return
+		}
+		aad := appendOpaque16([]byte{odohMessageResponse}, nonce)
+		ct := respAEAD.Seal(nil, iv, odohPlaintext(answer(t, q)), aad)
+		w.Header().Set("Content-Type", odohContentType)
+		_, _ = w.Write(appendOpaque16(aad, ct))
+	})
+	target.srv = httptest.NewServer(mux)
+	t.Cleanup(target.srv.Close)
+	return target
+}
+
+// newODoHProxy relays requests to the target named by the targethost and
+// targetpath parameters and counts them in relayed.
+func newODoHProxy(t *testing.T, relayed *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		relayed.Add(1)
+		q := r.URL.Query()
+		req, _ := http.NewRequest(r.Method, "http://"+q.Get("targethost")+q.Get("targetpath"), r.Body)
+		req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("proxy request failed: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestClientODoHThroughProxy(t *testing.T) {
+	target := newODoHTarget(t, answerA)
+	var relayed atomic.Int32
+	proxy := newODoHProxy(t, &relayed)
+
+	client := NewClient(WithProvider(Provider{URL: target.srv.URL + "/dns-query", Protocol: ProtocolODoH}),
+		WithODoHProxy(proxy.URL+"/proxy"))
+	for range 2 {
+		output, err := client.Query(context.Background(), "example.com", "A")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(output.Records) != 1 || output.Records[0].Data != "192.0.2.1" {
+			t.Fatalf("unexpected records: %+v", output.Records)
+		}
+	}
+	if n := relayed.Load(); n != 3 {
+		t.Fatalf("expected the configs and 2 queries through the proxy, got %d", n)
+	}
+	if n := target.configRequests.Load(); n != 1 {
+		t.Fatalf("expected configs to be fetched once, got %d", n)
+	}
+}
+
+func TestClientODoHFailoverThroughProxy(t *testing.T) {
+	down, _ := flakyServer(t, http.StatusServiceUnavailable, 100)
+	target := newODoHTarget(t, answerA)
+	var relayed atomic.Int32
+	proxy := newODoHProxy(t, &relayed)
+
+	client := NewClient(WithProvider(Provider{URL: down.URL, Protocol: ProtocolJSON}),
+		WithFailover(Provider{URL: target.srv.URL + "/dns-query", Protocol: ProtocolODoH}),
+		WithODoHProxy(proxy.URL+"/proxy"))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(output.Records) != 1 || output.Records[0].Data != "192.0.2.1" {
+		t.Fatalf("unexpected records: %+v", output.Records)
+	}
+	if n := relayed.Load(); n != 2 {
+		t.Fatalf("expected the configs and the query through the proxy, got %d", n)
+	}
+}
+
+func TestDoFormatODoHRcodeError(t *testing.T) {
+	target := newODoHTarget(t, func(t *testing.T, q dnsmessage.Message) []byte {
+		return packResponse(t, dnsmessage.Message{
+			Header:    dnsmessage.Header{RCode: dnsmessage.RCodeNameError},
+			Questions: q.Questions,
+		})
+	})
+
+	p, err := ParseProviderURL(strings.Replace(target.srv.URL, "http://", "odoh://", 1) + "/dns-query")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Protocol != ProtocolODoH || !strings.HasPrefix(p.URL, "https://") {
+		t.Fatalf("unexpected provider: %+v", p)
+	}
+	p.URL = target.srv.URL + "/dns-query"
+
+	var queryErr error
+	_ = captureStdout(t, func() {
+		queryErr = DoFormat("a", "missing.example.com", false, FormatJSON, DefaultProvider, WithProvider(p))
+	})
+	var rcodeErr RcodeError
+	if !errors.As(queryErr, &rcodeErr) || rcodeErr.Code != 3 {
+		t.Fatalf("expected NXDOMAIN RcodeError, got %v", queryErr)
+	}
+}
+
+func TestParseODoHConfigsSkipsUnsupported(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	unsupported := odohConfigContents(0x0020, 0x0001, 0xFFFF, key)
+	supported := odohConfigContents(0x0020, 0x0003, 0x0003, key)
+
+	configs, err := parseODoHConfigs(encodeODoHConfigs(unsupported, supported))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(configs) != 1 || configs[0].kdfID != 0x0003 || configs[0].aeadID != 0x0003 {
+		t.Fatalf("unexpected configs: %+v", configs)
+	}
+
+	if _, err := parseODoHConfigs(encodeODoHConfigs(unsupported)); err == nil || !strings.Contains(err.Error(), "no supported odoh config") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := parseODoHConfigs([]byte{0, 10, 0}); err == nil {
+		t.Fatal("expected error for truncated configs")
+	}
+}
@@ -0,0 +1,578 @@
+package query
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MXData is the parsed rdata of an MX record.
+type MXData struct {
+	Preference uint16 `json:"preference"`
+	Exchange   string `json:"exchange"`
+}
+
+// SRVData is the parsed rdata of an SRV record.
+type SRVData struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
+}
+
+// SOAData is the parsed rdata of an SOA record.
+type SOAData struct {
+	MName   string `json:"mname"`
+	RName   string `json:"rname"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	Minimum uint32 `json:"minimum"`
+}
+
+// CAAData is the parsed rdata of a CAA record.
+type CAAData struct {
+	Flags uint8  `json:"flags"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+// TXTData is the parsed rdata of a TXT or SPF record. Text is the
+// concatenation of all segments.
+type TXTData struct {
+	Segments []string `json:"segments"`
+	Text     string   `json:"text"`
+}
+
+// NAPTRData is the parsed rdata of a NAPTR record.
+type NAPTRData struct {
+	Order       uint16 `json:"order"`
+	Preference  uint16 `json:"preference"`
+	Flags       string `json:"flags"`
+	Services    string `json:"services"`
+	Regexp      string `json:"regexp"`
+	Replacement string `json:"replacement"`
+}
+
+// SSHFPData is the parsed rdata of an SSHFP record.
+type SSHFPData struct {
+	Algorithm   uint8  `json:"algorithm"`
+	Type        uint8  `json:"fingerprint_type"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// TLSAData is the parsed rdata of a TLSA or SMIMEA record.
+type TLSAData struct {
+	Usage        uint8  `json:"usage"`
+	Selector     uint8  `json:"selector"`
+	MatchingType uint8  `json:"matching_type"`
+	Certificate  string `json:"certificate"`
+}
+
+// DSData is the parsed rdata of a DS or CDS record.
+type DSData struct {
+	KeyTag     uint16 `json:"key_tag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digest_type"`
+	Digest     string `json:"digest"`
+}
+
+// DNSKEYData is the parsed rdata of a DNSKEY or CDNSKEY record. KeyTag is
+// computed from the key as described in RFC 4034 appendix B.
+type DNSKEYData struct {
+	Flags     uint16 `json:"flags"`
+	Protocol  uint8  `json:"protocol"`
+	Algorithm uint8  `json:"algorithm"`
+	PublicKey string `json:"public_key"`
+	KeyTag    uint16 `json:"key_tag"`
+}
+
+// RRSIGData is the parsed rdata of an RRSIG record. Expiration and
+// Inception keep the presentation form, YYYYMMDDHHmmSS or seconds since the
+// epoch.
+type RRSIGData struct {
+	TypeCovered string `json:"type_covered"`
+	Algorithm   uint8  `json:"algorithm"`
+	Labels      uint8  `json:"labels"`
+	OriginalTTL uint32 `json:"original_ttl"`
+	Expiration  string `json:"expiration"`
+	Inception   string `json:"inception"`
+	KeyTag      uint16 `json:"key_tag"`
+	SignerName  string `json:"signer_name"`
+	Signature   string `json:"signature"`
+}
+
+// NSECData is the parsed rdata of an NSEC record.
+type NSECData struct {
+	NextDomain string   `json:"next_domain"`
+	Types      []string `json:"types"`
+}
+
+// NSEC3Data is the parsed rdata of an NSEC3 record. Salt is "-" when empty.
+type NSEC3Data struct {
+	HashAlgorithm   uint8    `json:"hash_algorithm"`
+	Flags           uint8    `json:"flags"`
+	Iterations      uint16   `json:"iterations"`
+	Salt            string   `json:"salt"`
+	NextHashedOwner string   `json:"next_hashed_owner"`
+	Types           []string `json:"types"`
+}
+
+// SVCBData is the parsed rdata of an SVCB or HTTPS record. Params maps
+// SvcParamKey names to their presentation values; keys without a value,
+// such as no-default-alpn, map to an empty string.
+type SVCBData struct {
+	Priority uint16            `json:"priority"`
+	Target   string            `json:"target"`
+	Params   map[string]string `json:"params,omitempty"`
+}
+
+// parsedField is one labelled value shown in text output.
+type parsedField struct {
+	name  string
+	value string
+}
+
+// parsedRData is implemented by all parsed rdata types.
+type parsedRData interface {
+	fields() []parsedField
+}
+
+// rdataParsers decode presentation-format rdata, keyed on the same type
+// numbers as dnsTypeNames.
+var rdataParsers = map[int]func(p *presentationReader) parsedRData{
+	6:     parseSOA,
+	15:    parseMX,
+	16:    parseTXT,
+	33:    parseSRV,
+	35:    parseNAPTR,
+	43:    parseDS, // DS
+	44:    parseSSHFP,
+	46:    parseRRSIG,
+	47:    parseNSEC,
+	48:    parseDNSKEY, // DNSKEY
+	50:    parseNSEC3,
+	52:    parseTLSA,   // TLSA
+	53:    parseTLSA,   // SMIMEA
+	59:    parseDS,     // CDS
+	60:    parseDNSKEY, // CDNSKEY
+	64:    parseSVCB,   // SVCB
+	65:    parseSVCB,   // HTTPS
+	99:    parseTXT,    // SPF
+	257:   parseCAA,
+	32769: parseDS, // DLV
+}
+
+// parseRData decodes the presentation-format data of a record into one of
+// the *Data types. It returns nil for unsupported types and for data that
+// cannot be parsed, including the RFC 3597 generic "\#" encoding.
+func parseRData(rrtype int, data string) any {
+	parse, ok := rdataParsers[rrtype]
+	if !ok || strings.HasPrefix(data, `\#`) {
+		return nil
+	}
+	if (rrtype == 16 || rrtype == 99) && !strings.HasPrefix(strings.TrimSpace(data), `"`) {
+		// Some JSON APIs return TXT data without quotes, as a single
+		// unsplit string.
+		return &TXTData{Segments: []string{data}, Text: data}
+	}
+	fields, err := splitPresentation(data)
+	if err != nil {
+		return nil
+	}
+	p := &presentationReader{fields: fields}
+	parsed := parse(p)
+	if p.err != nil || p.remaining() > 0 {
+		return nil
+	}
+	return parsed
+}
+
+func parseMX(p *presentationReader) parsedRData {
+	return &MXData{Preference: p.uint16(), Exchange: p.field()}
+}
+
+func parseSRV(p *presentationReader) parsedRData {
+	return &SRVData{Priority: p.uint16(), Weight: p.uint16(), Port: p.uint16(), Target: p.field()}
+}
+
+func parseSOA(p *presentationReader) parsedRData {
+	return &SOAData{MName: p.field(), RName: p.field(), Serial: p.uint32(),
+		Refresh: p.uint32(), Retry: p.uint32(), Expire: p.uint32(), Minimum: p.uint32()}
+}
+
+func parseCAA(p *presentationReader) parsedRData {
+	return &CAAData{Flags: p.uint8(), Tag: p.field(), Value: p.text()}
+}
+
+func parseTXT(p *presentationReader) parsedRData {
+	var segments []string
+	for p.err == nil && p.remaining() > 0 {
+		segments = append(segments, p.text())
+	}
+	return &TXTData{Segments: segments, Text: strings.Join(segments, "")}
+}
+
+func parseNAPTR(p *presentationReader) parsedRData {
+	return &NAPTRData{Order: p.uint16(), Preference: p.uint16(), Flags: p.text(),
+		Services: p.text(), Regexp: p.text(), Replacement: p.field()}
+}
+
+func parseSSHFP(p *presentationReader) parsedRData {
+	return &SSHFPData{Algorithm: p.uint8(), Type: p.uint8(), Fingerprint: strings.ToLower(p.joinRest())}
+}
+
+func parseTLSA(p *presentationReader) parsedRData {
+	return &TLSAData{Usage: p.uint8(), Selector: p.uint8(), MatchingType: p.uint8(),
+		Certificate: strings.ToLower(p.joinRest())}
+}
+
+func parseDS(p *presentationReader) parsedRData {
+	return &DSData{KeyTag: p.uint16(), Algorithm: p.uint8(), DigestType: p.uint8(),
+		Digest: strings.ToUpper(p.joinRest())}
+}
+
+func parseDNSKEY(p *presentationReader) parsedRData {
+	d := &DNSKEYData{Flags: p.uint16(), Protocol: p.uint8(), Algorithm: p.uint8(), PublicKey: p.joinRest()}
+	key, err := base64.StdEncoding.DecodeString(d.PublicKey)
+	if err != nil {
+		p.fail(fmt.Errorf("invalid public key: %w", err))
+		return nil
+	}
+	d.KeyTag = keyTag(d.Flags, d.Protocol, d.Algorithm, key)
+	return d
+}
+
+func parseRRSIG(p *presentationReader) parsedRData {
+	return &RRSIGData{TypeCovered: strings.ToUpper(p.field()), Algorithm: p.uint8(), Labels: p.uint8(),
+		OriginalTTL: p.uint32(), Expiration: p.field(), Inception: p.field(), KeyTag: p.uint16(),
+		SignerName: p.field(), Signature: p.joinRest()}
+}
+
+func parseNSEC(p *presentationReader) parsedRData {
+	d := &NSECData{NextDomain: p.field()}
+	for p.err == nil && p.remaining() > 0 {
+		d.Types = append(d.Types, strings.ToUpper(p.field()))
+	}
+	return d
+}
+
+func parseNSEC3(p *presentationReader) parsedRData {
+	d := &NSEC3Data{HashAlgorithm: p.uint8(), Flags: p.uint8(), Iterations: p.uint16(),
+		Salt: strings.ToUpper(p.field()), NextHashedOwner: strings.ToUpper(p.field())}
+	for p.err == nil && p.remaining() > 0 {
+		d.Types = append(d.Types, strings.ToUpper(p.field()))
+	}
+	return d
+}
+
+func parseSVCB(p *presentationReader) parsedRData {
+	d := &SVCBData{Priority: p.uint16(), Target: p.field()}
+	for p.err == nil && p.remaining() > 0 {
+		key, value, _ := strings.Cut(p.field(), "=")
+		if d.Params == nil {
+			d.Params = make(map[string]string)
+		}
+		d.Params[key] = value
+	}
+	return d
+}
+
+// keyTag computes the DNSKEY key tag (RFC 4034 appendix B).
+func keyTag(flags uint16, protocol, algorithm uint8, key []byte) uint16 {
+	if algorithm == 1 { // RSA/MD5 uses the low 16 bits of the modulus
+		if len(key) < 3 {
+			return 0
+		}
+		return uint16(key[len(key)-3])<<8 | uint16(key[len(key)-2])
+	}
+	rdata := append([]byte{byte(flags >> 8), byte(flags), protocol, algorithm}, key...)
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xFFFF
+	return uint16(ac)
+}
+
+func (d *MXData) fields() []parsedField {
+	return []parsedField{{"preference", strconv.Itoa(int(d.Preference))}, {"exchange", d.Exchange}}
+}
+
+func (d *SRVData) fields() []parsedField {
+	return []parsedField{
+		{"priority", strconv.Itoa(int(d.Priority))},
+		{"weight", strconv.Itoa(int(d.Weight))},
+		{"port", strconv.Itoa(int(d.Port))},
+		{"target", d.Target},
+	}
+}
+
+func (d *SOAData) fields() []parsedField {
+	return []parsedField{
+		{"mname", d.MName},
+		{"rname", d.RName},
+		{"serial", strconv.FormatUint(uint64(d.Serial), 10)},
+		{"refresh", ttlHuman(int(d.Refresh))},
+		{"retry", ttlHuman(int(d.Retry))},
+		{"expire", ttlHuman(int(d.Expire))},
+		{"minimum", ttlHuman(int(d.Minimum))},
+	}
+}
+
+func (d *CAAData) fields() []parsedField {
+	return []parsedField{{"flags", strconv.Itoa(int(d.Flags))}, {"tag", d.Tag}, {"value", d.Value}}
+}
+
+func (d *TXTData) fields() []parsedField {
+	if len(d.Segments) == 1 {
+		return []parsedField{{"text", d.Text}}
+	}
+	fields := make([]parsedField, 0, len(d.Segments)+1)
+	for i, s := range d.Segments {
+		fields = append(fields, parsedField{fmt.Sprintf("segment %d", i+1), s})
+	}
+	return append(fields, parsedField{"text", d.Text})
+}
+
+func (d *NAPTRData) fields() []parsedField {
+	return []parsedField{
+		{"order", strconv.Itoa(int(d.Order))},
+		{"preference", strconv.Itoa(int(d.Preference))},
+		{"flags", d.Flags},
+		{"services", d.Services},
+		{"regexp", d.Regexp},
+		{"replacement", d.Replacement},
+	}
+}
+
+func (d *SSHFPData) fields() []parsedField {
+	return []parsedField{
+		{"algorithm", strconv.Itoa(int(d.Algorithm))},
+		{"fingerprint type", strconv.Itoa(int(d.Type))},
+		{"fingerprint", d.Fingerprint},
+	}
+}
+
+func (d *TLSAData) fields() []parsedField {
+	return []parsedField{
+		{"usage", strconv.Itoa(int(d.Usage))},
+		{"selector", strconv.Itoa(int(d.Selector))},
+		{"matching type", strconv.Itoa(int(d.MatchingType))},
+		{"certificate", d.Certificate},
+	}
+}
+
+func (d *DSData) fields() []parsedField {
+	return []parsedField{
+		{"key tag", strconv.Itoa(int(d.KeyTag))},
+		{"algorithm", strconv.Itoa(int(d.Algorithm))},
+		{"digest type", strconv.Itoa(int(d.DigestType))},
+		{"digest", d.Digest},
+	}
+}
+
+func (d *DNSKEYData) fields() []parsedField {
+	return []parsedField{
+		{"flags", strconv.Itoa(int(d.Flags))},
+		{"protocol", strconv.Itoa(int(d.Protocol))},
+		{"algorithm", strconv.Itoa(int(d.Algorithm))},
+		{"key tag", strconv.Itoa(int(d.KeyTag))},
+		{"public key", d.PublicKey},
+	}
+}
+
+func (d *RRSIGData) fields() []parsedField {
+	return []parsedField{
+		{"type covered", d.TypeCovered},
+		{"algorithm", strconv.Itoa(int(d.Algorithm))},
+		{"labels", strconv.Itoa(int(d.Labels))},
+		{"original ttl", strconv.FormatUint(uint64(d.OriginalTTL), 10)},
+		{"expiration", d.Expiration},
+		{"inception", d.Inception},
+		{"key tag", strconv.Itoa(int(d.KeyTag))},
+		{"signer name", d.SignerName},
+		{"signature", d.Signature},
+	}
+}
+
+func (d *NSECData) fields() []parsedField {
+	return []parsedField{{"next domain", d.NextDomain}, {"types", strings.Join(d.Types, " ")}}
+}
+
+func (d *NSEC3Data) fields() []parsedField {
+	return []parsedField{
+		{"hash algorithm", strconv.Itoa(int(d.HashAlgorithm))},
+		{"flags", strconv.Itoa(int(d.Flags))},
+		{"iterations", strconv.Itoa(int(d.Iterations))},
+		{"salt", d.Salt},
+		{"next hashed owner", d.NextHashedOwner},
+		{"types", strings.Join(d.Types, " ")},
+	}
+}
+
+func (d *SVCBData) fields() []parsedField {
+	fields := []parsedField{{"priority", strconv.Itoa(int(d.Priority))}, {"target", d.Target}}
+	for _, key := range slices.Sorted(maps.Keys(d.Params)) {
+		fields = append(fields, parsedField{key, d.Params[key]})
+	}
+	return fields
+}
+
+// splitPresentation splits presentation-format rdata on whitespace. Quotes
+// group characters into a field and are removed; backslash escapes are kept
+// so names stay escaped and character-strings can be decoded with
+// unescapeCharacterString.
+func splitPresentation(data string) ([]string, error) {
+	var fields []string
+	var b strings.Builder
+	inField, inQuote := false, false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(data) {
+				return nil, errors.New("trailing backslash")
+			}
+			b.WriteByte(c)
+			b.WriteByte(data[i+1])
+			i++
+			inField = true
+		case c == '"':
+			inQuote = !inQuote
+			inField = true
+		case !inQuote && (c == ' ' || c == '\t'):
+			if inField {
+				fields = append(fields, b.String())
+				b.Reset()
+				inField = false
+			}
+		default:
+			b.WriteByte(c)
+			inField = true
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if inField {
+		fields = append(fields, b.String())
+	}
+	return fields, nil
+}
+
+// unescapeCharacterString decodes the \X and \DDD escapes of a
+// character-string.
+func unescapeCharacterString(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 < len(s) && isDigit(s[i+1]) {
+			n, err := strconv.ParseUint(s[i+1:i+4], 10, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape %q", s[i:i+4])
+			}
+			b.WriteByte(byte(n))
+			i += 3
+			continue
+		}
+		if i+1 < len(s) {
+			b.WriteByte(s[i+1])
+			i++
+		}
+	}
+	return b.String(), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// presentationReader consumes presentation-format fields. Like rdataReader,
+// the first error is sticky.
+type presentationReader struct {
+	fields []string
+	err    error
+}
+
+func (p *presentationReader) remaining() int {
+	return len(p.fields)
+}
+
+func (p *presentationReader) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *presentationReader) field() string {
+	if p.err != nil {
+		return ""
+	}
+	if len(p.fields) == 0 {
+		p.fail(errors.New("missing rdata field"))
+		return ""
+	}
+	f := p.fields[0]
+	p.fields = p.fields[1:]
+	return f
+}
+
+// text reads a character-string field and decodes its escapes.
+func (p *presentationReader) text() string {
+	s, err := unescapeCharacterString(p.field())
+	if err != nil {
+		p.fail(err)
+	}
+	return s
+}
+
+// joinRest concatenates the remaining fields, as used by base64 and hex
+// values that may be split by whitespace.
+func (p *presentationReader) joinRest() string {
+	if p.err != nil {
+		return ""
+	}
+	s := strings.Join(p.fields, "")
+	p.fields = nil
+	return s
+}
+
+func (p *presentationReader) uint(bits int) uint64 {
+	f := p.field()
+	if p.err != nil {
+		return 0
+	}
+	n, err := strconv.ParseUint(f, 10, bits)
+	if err != nil {
+		p.fail(fmt.Errorf("invalid number %q", f))
+	}
+	return n
+}
+
+func (p *presentationReader) uint8() uint8 {
+	return uint8(p.uint(8))
+}
+
+func (p *presentationReader) uint16() uint16 {
+	return uint16(p.uint(16))
+}
+
+func (p *presentationReader) uint32() uint32 {
+	return uint32(p.uint(32))
+}
@@ -0,0 +1,99 @@
+package query
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rootKSK is the 2017 root zone key signing key, key tag 20326.
+const rootKSK = "AwEAAaz/tAm8yTn4Mfeh5eyI96WSVexTBAvkMgJzkKTOiW1vkIbzxeF3+/4RgWOq7HrxRixHlFlExOLAJr5emLvN7SWXgnLh4+B5xQlNVz8Og8kvArMtNROxVQuCaSnIDdD5LKyWbRd2n9WGe2R8PzgCmr3EgVLrjyBxWezF0jLHwVN8efS3rCj/EWgvIWgb9tarpVUDK/b58Da+sqqls3eNbuv7pr+eoZG+SrDK6nWeL3c6H5Apxz7LjVc1uTIdsIXxuOLYA4/ilBmSVIzuDWfdRUfhHdY6+cn8HFRm+2hM8AnXGXws9555KrUB5qihylGa8subX2Nn6UwNR1AkUTV74bU="
+
+func TestParseRData(t *testing.T) {
+	tests := []struct {
+		rrtype int
+		data   string
+		want   any
+	}{
+		{15, "10 mail.example.com.", &MXData{Preference: 10, Exchange: "mail.example.com."}},
+		{33, "10 5 5060 sip.example.com.", &SRVData{Priority: 10, Weight: 5, Port: 5060, Target: "sip.example.com."}},
+		{6, "ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300",
+			&SOAData{MName: "ns1.example.com.", RName: "hostmaster.example.com.", Serial: 2024010101,
+				Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300}},
+		{257, `0 issue "letsencrypt.org"`, &CAAData{Flags: 0, Tag: "issue", Value: "letsencrypt.org"}},
+		{16, `"v=spf1 include:_spf.example.com" " ~all"`,
+			&TXTData{Segments: []string{"v=spf1 include:_spf.example.com", " ~all"}, Text: "v=spf1 include:_spf.example.com ~all"}},
+		{16, `"say \"hi\"\059"`, &TXTData{Segments: []string{`say "hi";`}, Text: `say "hi";`}},
+		{16, "v=spf1 -all", &TXTData{Segments: []string{"v=spf1 -all"}, Text: "v=spf1 -all"}},
+		{35, `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`,
+			&NAPTRData{Order: 100, Preference: 10, Flags: "S", Services: "SIP+D2U", Replacement: "_sip._udp.example.com."}},
+		{44, "4 2 ABCDEF01", &SSHFPData{Algorithm: 4, Type: 2, Fingerprint: "abcdef01"}},
+		{52, "3 1 1 0A0B 0C0D", &TLSAData{Usage: 3, Selector: 1, MatchingType: 1, Certificate: "0a0b0c0d"}},
+		{43, "20326 8 2 e06d44b80b8f1d39", &DSData{KeyTag: 20326, Algorithm: 8, DigestType: 2, Digest: "E06D44B80B8F1D39"}},
+		{48, "257 3 8 " + rootKSK, &DNSKEYData{Flags: 257, Protocol: 3, Algorithm: 8, PublicKey: rootKSK, KeyTag: 20326}},
+		{65, `1 . alpn="h3,h2" ipv4hint=192.0.2.1 no-default-alpn`,
+			&SVCBData{Priority: 1, Target: ".", Params: map[string]string{"alpn": "h3,h2", "ipv4hint": "192.0.2.1", "no-default-alpn": ""}}},
+		{65, "0 svc.example.com.", &SVCBData{Priority: 0, Target: "svc.example.com."}},
+	}
+	for _, tt := range tests {
+		got := parseRData(tt.rrtype, tt.data)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("parseRData(%d, %q) = %+v, want %+v", tt.rrtype, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseRDataRejectsInvalidData(t *testing.T) {
+	for _, tt := range []struct {
+		rrtype int
+		data   string
+	}{
+		{1, "192.0.2.1"},
+		{15, "mail.example.com."},
+		{15, "10 mail.example.com. extra"},
+		{33, "70000 5 5060 sip.example.com."},
+		{16, `"unterminated`},
+		{48, "257 3 8 not-base64!"},
+		{65, "x svc.example.com. alpn=h2"},
+		{43, `\# 4 0A0B0C0D`},
+	} {
+		if got := parseRData(tt.rrtype, tt.data); got != nil {
+			t.Fatalf("parseRData(%d, %q) = %+v, want nil", tt.rrtype, tt.data, got)
+		}
+	}
+}
+
+func TestParsedRecordOutput(t *testing.T) {
+	output := makeJSONOutput(dohResponse{Status: 0, Answer: []dohRecord{
+		{Name: "example.com.", Type: 15, TTL: 300, Data: "10 mail.example.com."},
+		{Name: "example.com.", Type: 1, TTL: 300, Data: "192.0.2.1"},
+	}}, false)
+
+	jsonOut := captureStdout(t, func() {
+		if err := OutputResponse(output, FormatNDJSON); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	var got struct {
+		Records []map[string]json.RawMessage `json:"records"`
+	}
+	if err := json.Unmarshal([]byte(jsonOut), &got); err != nil {
+		t.Fatalf("expected valid json, got %q: %v", jsonOut, err)
+	}
+	if parsed := string(got.Records[0]["parsed"]); parsed != `{"preference":10,"exchange":"mail.example.com."}` {
+		t.Fatalf("unexpected parsed MX data: %s", parsed)
+	}
+	if _, ok := got.Records[1]["parsed"]; ok {
+		t.Fatalf("expected no parsed data for A record: %s", jsonOut)
+	}
+
+	text := captureStdout(t, func() {
+		if err := OutputResponse(output, FormatText); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	if !strings.Contains(text, "  preference: 10\n  exchange: mail.example.com.\n") {
+		t.Fatalf("expected parsed fields in text output, got:\n%s", text)
+	}
+}
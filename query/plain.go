@@ -0,0 +1,99 @@
+package query
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// plainPort is the classic DNS port.
+const plainPort = "53"
+
+// maxUDPSize is the largest UDP message accepted from a server.
+const maxUDPSize = 65535
+
+// queryUDP resolves domain with a plain DNS query over UDP and repeats it
+// over TCP when the response is truncated.
+func (c *Client) queryUDP(ctx context.Context, domain, queryType string) ([]byte, error) {
+	msg, err := c.newStreamQuery(domain, queryType)
+	if err != nil {
+		return nil, err
+	}
+	content, err := c.exchangeUDP(ctx, msg)
+	if err != nil {
+		return nil, fmt.Errorf("exchange error: %w", err)
+	}
+
+	var p dnsmessage.Parser
+	if h, err := p.Start(content); err == nil && h.Truncated {
+		content, err = c.exchangePooled(ctx, msg, c.dialTCP)
+		if err != nil {
+			return nil, fmt.Errorf("tcp fallback: %w", err)
+		}
+	}
+	return content, nil
+}
+
+// queryTCP resolves domain with a plain DNS query over TCP.
+func (c *Client) queryTCP(ctx context.Context, domain, queryType string) ([]byte, error) {
+	msg, err := c.newStreamQuery(domain, queryType)
+	if err != nil {
+		return nil, err
+	}
+	content, err := c.exchangePooled(ctx, msg, c.dialTCP)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// exchangeUDP sends msg in a single datagram and waits for the response
+// with the same ID. Datagrams with other IDs are ignored.
+func (c *Client) exchangeUDP(ctx context.Context, msg []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", c.plainAddr())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	defer bindDeadline(ctx, conn)()
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && binary.BigEndian.Uint16(buf) == binary.BigEndian.Uint16(msg) {
+			return buf[:n], nil
+		}
+	}
+}
+
+// dialTCP opens a TCP connection to the provider.
+func (c *Client) dialTCP(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", c.plainAddr())
+}
+
+// plainAddr returns the host:port of a udp:// or tcp:// provider URL.
+func (c *Client) plainAddr() string {
+	u, err := url.Parse(c.provider.URL)
+	if err != nil {
+		return c.provider.URL
+	}
+	port := u.Port()
+	if port == "" {
+		port = plainPort
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
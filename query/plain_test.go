@@ -0,0 +1,177 @@
+package query
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// plainServer answers plain DNS queries over UDP and TCP on the same port.
+type plainServer struct {
+	udp         net.PacketConn
+	tcp         net.Listener
+	tcpAccepted atomic.Int32
+	wg          sync.WaitGroup
+}
+
+// newPlainServer starts a UDP and TCP server. udpAnswer returns the
+// datagrams sent for every UDP query; TCP queries are answered with answer.
+func newPlainServer(t *testing.T, udpAnswer func(t *testing.T, q dnsmessage.Message) [][]byte, answer func(t *testing.T, q dnsmessage.Message) []byte) *plainServer {
+	t.Helper()
+	s := &plainServer{}
+	for range 10 {
+		udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		port := udp.LocalAddr().(*net.UDPAddr).Port
+		tcp, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+		if err != nil {
+			_ = udp.Close()
+			continue
+		}
+		s.udp, s.tcp = udp, tcp
+		break
+	}
+	if s.udp == nil {
+		t.Fatal("failed to listen on a shared UDP and TCP port")
+	}
+
+	s.wg.Go(func() {
+		buf := make([]byte, maxUDPSize)
+		for {
+			n, addr, err := s.udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var q dnsmessage.Message
+			if err := q.Unpack(buf[:n]); err != nil {
+				t.Errorf("failed to unpack query: %v", err)
+				return
+			}
+			for _, resp := range udpAnswer(t, q) {
+				_, _ = s.udp.WriteTo(resp, addr)
+			}
+		}
+	})
+	s.wg.Go(func() {
+		for {
+			conn, err := s.tcp.Accept()
+			if err != nil {
+				return
+			}
+			s.tcpAccepted.Add(1)
+			s.wg.Go(func() {
+				defer func() {
+					_ = conn.Close()
+				}()
+				for {
+					raw, err := readStreamMessage(conn)
+					if err != nil {
+						return
+					}
+					var q dnsmessage.Message
+					if err := q.Unpack(raw); err != nil {
+						t.Errorf("failed to unpack query: %v", err)
+						return
+					}
+					if err := writeStreamMessage(conn, answer(t, q)); err != nil {
+						return
+					}
+				}
+			})
+		}
+	})
+	t.Cleanup(func() {
+		_ = s.udp.Close()
+		_ = s.tcp.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+func (s *plainServer) url(scheme string) string {
+	return scheme + "://" + s.udp.LocalAddr().String()
+}
+
+func TestParseProviderURLPlain(t *testing.T) {
+	for scheme, want := range map[string]Protocol{"udp": ProtocolUDP, "tcp": ProtocolTCP} {
+		p, err := ParseProviderURL(scheme + "://10.0.0.53")
+		if err != nil || p.Protocol != want {
+			t.Fatalf("unexpected provider %+v: %v", p, err)
+		}
+	}
+}
+
+func TestClientUDPIgnoresMismatchedID(t *testing.T) {
+	srv := newPlainServer(t, func(t *testing.T, q dnsmessage.Message) [][]byte {
+		spoofed := q
+		spoofed.ID++
+		return [][]byte{answerA(t, spoofed), answerA(t, q)}
+	}, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.url("udp"), Protocol: ProtocolUDP}))
+
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(output.Records) != 1 || output.Records[0].Data != "192.0.2.1" {
+		t.Fatalf("unexpected records: %+v", output.Records)
+	}
+	if n := srv.tcpAccepted.Load(); n != 0 {
+		t.Fatalf("expected no TCP connection, got %d", n)
+	}
+}
+
+func TestClientUDPFallsBackToTCP(t *testing.T) {
+	srv := newPlainServer(t, func(t *testing.T, q dnsmessage.Message) [][]byte {
+		return [][]byte{packResponse(t, dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, Truncated: true},
+			Questions: q.Questions,
+		})}
+	}, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.url("udp"), Protocol: ProtocolUDP}))
+	defer func() {
+		_ = client.Close()
+	}()
+
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.Flags.Truncated || len(output.Records) != 1 {
+		t.Fatalf("expected the full TCP response, got %+v", output)
+	}
+	if n := srv.tcpAccepted.Load(); n != 1 {
+		t.Fatalf("expected one TCP connection, got %d", n)
+	}
+}
+
+func TestClientTCP(t *testing.T) {
+	srv := newPlainServer(t, func(t *testing.T, q dnsmessage.Message) [][]byte {
+		t.Error("unexpected UDP query")
+		return nil
+	}, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.url("tcp"), Protocol: ProtocolTCP}))
+	defer func() {
+		_ = client.Close()
+	}()
+
+	for range 2 {
+		output, err := client.Query(context.Background(), "example.com", "A")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(output.Records) != 1 {
+			t.Fatalf("unexpected records: %+v", output.Records)
+		}
+	}
+	if n := srv.tcpAccepted.Load(); n != 1 {
+		t.Fatalf("expected a single reused connection, got %d", n)
+	}
+}
@@ -0,0 +1,217 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Default polling intervals of a Propagation.
+const (
+	DefaultPropagateInterval    = 2 * time.Second
+	DefaultPropagateMaxInterval = time.Minute
+)
+
+// Propagation polls several providers until every one of them returns the
+// expected records, e.g. after a record change.
+type Propagation struct {
+	Providers []string
+	Name      string
+	Type      string
+	// Expect are the record data that every provider has to return, such
+	// as "192.0.2.1". They are normalized like the answers, so TXT data
+	// matches with or without quotes. Answers may hold further records.
+	Expect []string
+	// Interval is the delay before a provider is queried again; it doubles
+	// after every miss up to MaxInterval.
+	Interval    time.Duration
+	MaxInterval time.Duration
+	// Update, if set, is called with a snapshot of all checks after every
+	// query. It is never called concurrently.
+	Update func([]PropagationCheck)
+	// Options are applied to every client before its provider. WithFailover
+	// and WithRace are ignored, as every provider has to answer on its own.
+	Options []Option
+}
+
+// PropagationCheck is the state of one provider during a Propagation.
+type PropagationCheck struct {
+	Provider  string    `json:"provider"`
+	Matched   bool      `json:"matched"`
+	Attempts  int       `json:"attempts"`
+	Status    string    `json:"status,omitempty"`
+	Answers   []string  `json:"answers"`
+	Error     string    `json:"error,omitempty"`
+	MatchedAt time.Time `json:"matched_at,omitzero"`
+}
+
+// Run queries every provider with exponential backoff until all of them
+// return the expected records or ctx is done. It returns the final checks,
+// and an error wrapping the context error if some providers never matched.
+func (p *Propagation) Run(ctx context.Context) ([]PropagationCheck, error) {
+	if len(p.Providers) == 0 {
+		return nil, errors.New("no providers given")
+	}
+	if len(p.Expect) == 0 {
+		return nil, errors.New("no expected records given")
+	}
+	qtype, err := parseDNSType(p.Type)
+	if err != nil {
+		return nil, err
+	}
+	expect := make([]string, len(p.Expect))
+	for i, e := range p.Expect {
+		expect[i] = normalizeData(int(qtype), e)
+	}
+	provs := make([]Provider, len(p.Providers))
+	for i, name := range p.Providers {
+		provs[i], err = LookupProvider(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	clients := make([]*Client, len(provs))
+	for i, provider := range provs {
+		clients[i] = NewClient(append(slices.Clone(p.Options), soloProvider(provider))...)
+	}
+	defer func() {
+		for _, c := range clients {
+			_ = c.Close()
+		}
+	}()
+
+	interval, maxInterval := p.Interval, p.MaxInterval
+	if interval <= 0 {
+		interval = DefaultPropagateInterval
+	}
+	if maxInterval <= 0 {
+		maxInterval = DefaultPropagateMaxInterval
+	}
+	maxInterval = max(maxInterval, interval)
+
+	checks := make([]PropagationCheck, len(clients))
+	for i, name := range p.Providers {
+		checks[i] = PropagationCheck{Provider: name, Answers: []string{}}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Go(func() {
+			delay := interval
+			for attempt := 1; ; attempt++ {
+				check := p.check(ctx, c, int(qtype), expect)
+				if ctx.Err() != nil {
+					return
+				}
+				check.Provider, check.Attempts = p.Providers[i], attempt
+
+				mu.Lock()
+				checks[i] = check
+				if p.Update != nil {
+					p.Update(slices.Clone(checks))
+				}
+				mu.Unlock()
+				if check.Matched {
+					return
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+				delay = min(delay*2, maxInterval)
+			}
+		})
+	}
+	wg.Wait()
+
+	pending := 0
+	for _, check := range checks {
+		if !check.Matched {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return checks, fmt.Errorf("%d of %d providers do not return the expected records: %w", pending, len(checks), ctx.Err())
+	}
+	return checks, nil
+}
+
+// check queries one provider and compares its answer with expect.
+func (p *Propagation) check(ctx context.Context, c *Client, qtype int, expect []string) PropagationCheck {
+	check := PropagationCheck{Answers: []string{}}
+	output, err := c.Query(ctx, p.Name, p.Type)
+	var rcodeErr RcodeError
+	if errors.As(err, &rcodeErr) {
+		output, err = &rcodeErr.Response, nil
+	}
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	check.Status = output.StatusName
+	for _, r := range output.Records {
+		if r.Type == qtype {
+			check.Answers = append(check.Answers, normalizeData(r.Type, r.Data))
+		}
+	}
+	check.Matched = true
+	for _, e := range expect {
+		if !slices.Contains(check.Answers, e) {
+			check.Matched = false
+		}
+	}
+	if check.Matched {
+		check.MatchedAt = time.Now()
+	}
+	return check
+}
+
+// FormatPropagation renders checks as a table with one row per provider.
+func FormatPropagation(checks []PropagationCheck) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PROVIDER\tSTATE\tATTEMPTS\tANSWER")
+	for _, c := range checks {
+		state, answer := "waiting", strings.Join(c.Answers, ", ")
+		switch {
+		case c.Matched:
+			state = "matched"
+		case c.Error != "":
+			state, answer = "error", c.Error
+		case c.Attempts == 0:
+			state = "pending"
+		case len(c.Answers) == 0:
+			answer = c.Status
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", c.Provider, state, c.Attempts, answer)
+	}
+	_ = w.Flush()
+	return buf.String()
+}
+
+// OutputPropagation prints the checks of a Propagation in text or JSON
+// format.
+func OutputPropagation(checks []PropagationCheck, format string) error {
+	if format == FormatJSON {
+		b, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			return fmt.Errorf("json marshal error: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	fmt.Print(FormatPropagation(checks))
+	return nil
+}
@@ -0,0 +1,100 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestPropagation(t *testing.T) {
+	ready := newWireServer(t, http.MethodGet, answerA)
+	var queries atomic.Int32
+	slow := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		if queries.Add(1) < 3 {
+			return packResponse(t, dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: q.ID, RCode: dnsmessage.RCodeNameError},
+				Questions: q.Questions,
+			})
+		}
+		return answerA(t, q)
+	})
+
+	updates := 0
+	p := &Propagation{
+		Providers: []string{ready.URL, slow.URL},
+		Name:      "example.com",
+		Type:      "A",
+		Expect:    []string{"192.0.2.1"},
+		Interval:  time.Millisecond,
+		Update:    func([]PropagationCheck) { updates++ },
+	}
+	checks, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !checks[0].Matched || checks[0].Attempts != 1 || !checks[1].Matched || checks[1].Attempts != 3 {
+		t.Fatalf("unexpected checks: %+v", checks)
+	}
+	if updates != 4 {
+		t.Fatalf("got %d updates, want 4", updates)
+	}
+	if table := FormatPropagation(checks); !strings.Contains(table, "matched") || strings.Count(table, "\n") != 3 {
+		t.Fatalf("unexpected table:\n%s", table)
+	}
+}
+
+func TestPropagationTXT(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		return packResponse(t, dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.ID, RecursionAvailable: true},
+			Questions: q.Questions,
+			Answers: []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.TXTResource{TXT: []string{"v=spf1 include:_spf.example.com ", "-all"}},
+			}},
+		})
+	})
+
+	for _, expect := range []string{"v=spf1 include:_spf.example.com -all", `"v=spf1 include:_spf.example.com -all"`} {
+		p := &Propagation{
+			Providers: []string{srv.URL},
+			Name:      "example.com",
+			Type:      "TXT",
+			Expect:    []string{expect},
+			Interval:  time.Millisecond,
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		checks, err := p.Run(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("expect %s: unexpected error: %v, checks: %+v", expect, err, checks)
+		}
+	}
+}
+
+func TestPropagationDeadline(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, answerA)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	p := &Propagation{
+		Providers: []string{srv.URL},
+		Name:      "example.com",
+		Type:      "A",
+		Expect:    []string{"192.0.2.1", "192.0.2.2"},
+		Interval:  10 * time.Millisecond,
+	}
+	checks, err := p.Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(checks) != 1 || checks[0].Matched || checks[0].Attempts == 0 || checks[0].Answers[0] != "192.0.2.1" {
+		t.Fatalf("unexpected checks: %+v", checks)
+	}
+}
@@ -0,0 +1,312 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Protocol identifies the DNS-over-HTTPS dialect spoken by a provider.
+type Protocol string
+
+const (
+	// ProtocolJSON is the application/dns-json API offered by Cloudflare and Google.
+	ProtocolJSON Protocol = "json"
+	// ProtocolWire is the RFC 8484 application/dns-message format.
+	ProtocolWire Protocol = "wire"
+	// ProtocolDoT is DNS over TLS (RFC 7858), addressed as tls://host[:port].
+	ProtocolDoT Protocol = "dot"
+	// ProtocolDoQ is DNS over QUIC (RFC 9250), addressed as quic://host[:port].
+	ProtocolDoQ Protocol = "doq"
+	// ProtocolODoH is Oblivious DNS over HTTPS (RFC 9230). The URL is the
+	// target; queries are relayed through Provider.Proxy when set.
+	ProtocolODoH Protocol = "odoh"
+	// ProtocolUDP is classic DNS over UDP, addressed as udp://host[:port].
+	// Truncated responses are repeated over TCP.
+	ProtocolUDP Protocol = "udp"
+	// ProtocolTCP is classic DNS over TCP, addressed as tcp://host[:port].
+	ProtocolTCP Protocol = "tcp"
+)
+
+// Provider describes a DNS-over-HTTPS, DNS-over-TLS, DNS-over-QUIC or
+// plain DNS endpoint.
+type Provider struct {
+	URL      string   `yaml:"url"`
+	Protocol Protocol `yaml:"protocol"`
+	// Method is the HTTP method used for wire-format queries (GET or POST).
+	// JSON providers always use GET.
+	Method string `yaml:"method,omitempty"`
+	// Headers are added to every request sent to the provider.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// HTTP3 sends DNS-over-HTTPS requests over HTTP/3 instead of HTTP/1.1
+	// or HTTP/2.
+	HTTP3 bool `yaml:"http3,omitempty"`
+	// Proxy is the Oblivious DoH proxy that relays queries to the target
+	// given by URL.
+	Proxy string `yaml:"proxy,omitempty"`
+	// ServerName overrides the host name sent in SNI and checked against the
+	// server certificate of TLS transports, e.g. when the URL holds an IP.
+	ServerName string `yaml:"server_name,omitempty"`
+	// WireURL is the RFC 8484 endpoint of a JSON provider, used where raw
+	// wire-format responses are needed, e.g. for DNSSEC validation.
+	WireURL string `yaml:"wire_url,omitempty"`
+}
+
+// Validate reports whether the provider can be used for queries.
+func (p Provider) Validate() error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+
+	method := strings.ToUpper(p.Method)
+	switch p.Protocol {
+	case ProtocolJSON:
+		if err := checkHTTPURL(u, p.URL); err != nil {
+			return err
+		}
+		if method != "" && method != http.MethodGet {
+			return fmt.Errorf("unsupported method %s for json protocol", p.Method)
+		}
+		if p.WireURL != "" {
+			wire, err := url.Parse(p.WireURL)
+			if err != nil {
+				return fmt.Errorf("invalid wire_url: %w", err)
+			}
+			if err := checkHTTPURL(wire, p.WireURL); err != nil {
+				return err
+			}
+		}
+	case ProtocolWire:
+		if err := checkHTTPURL(u, p.URL); err != nil {
+			return err
+		}
+		if method != "" && method != http.MethodGet && method != http.MethodPost {
+			return fmt.Errorf("unsupported method %s for wire protocol", p.Method)
+		}
+	case ProtocolDoT:
+		if err := checkStreamURL(u, p.URL, "tls", p.Protocol); err != nil {
+			return err
+		}
+	case ProtocolDoQ:
+		if err := checkStreamURL(u, p.URL, "quic", p.Protocol); err != nil {
+			return err
+		}
+	case ProtocolODoH:
+		if err := checkHTTPURL(u, p.URL); err != nil {
+			return err
+		}
+		if p.Proxy != "" {
+			proxy, err := url.Parse(p.Proxy)
+			if err != nil {
+				return fmt.Errorf("invalid proxy url: %w", err)
+			}
+			if err := checkHTTPURL(proxy, p.Proxy); err != nil {
+				return err
+			}
+		}
+	case ProtocolUDP, ProtocolTCP:
+		if err := checkStreamURL(u, p.URL, string(p.Protocol), p.Protocol); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown protocol %q (valid protocols: json, wire, dot, doq, odoh, udp, tcp)", p.Protocol)
+	}
+	if p.HTTP3 && (u.Scheme != "https" || (p.Protocol != ProtocolJSON && p.Protocol != ProtocolWire)) {
+		return fmt.Errorf("http3 requires an https url and the json or wire protocol")
+	}
+	return nil
+}
+
+// wireProvider returns the provider to send wire-format queries to. JSON
+// providers are replaced by their WireURL endpoint.
+func (p Provider) wireProvider() (Provider, error) {
+	if p.Protocol != ProtocolJSON && p.Protocol != "" {
+		return p, nil
+	}
+	if p.WireURL == "" {
+		return Provider{}, fmt.Errorf("provider %s only serves the JSON API; set wire_url in the config file or use --provider-url with an RFC 8484 endpoint", p.URL)
+	}
+	p.URL, p.Protocol, p.Method = p.WireURL, ProtocolWire, http.MethodGet
+	return p, nil
+}
+
+func checkHTTPURL(u *url.URL, raw string) error {
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("invalid url %q: scheme must be https or http", raw)
+	}
+	return nil
+}
+
+func checkStreamURL(u *url.URL, raw, scheme string, protocol Protocol) error {
+	if u.Scheme != scheme {
+		return fmt.Errorf("invalid url %q: scheme must be %s for %s protocol", raw, scheme, protocol)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("invalid url %q: missing host", raw)
+	}
+	return nil
+}
+
+// Registry holds named providers.
+type Registry struct {
+	providers map[string]Provider
+}
+
+// Providers available without a configuration file
+var builtinProviders = map[string]Provider{
+	"cloudflare": {URL: "https://cloudflare-dns.com/dns-query", Protocol: ProtocolJSON, WireURL: "https://cloudflare-dns.com/dns-query"},
+	"google":     {URL: "https://dns.google/resolve", Protocol: ProtocolJSON, WireURL: "https://dns.google/dns-query"},
+	"quad9":      {URL: "https://dns.quad9.net/dns-query", Protocol: ProtocolWire, Method: http.MethodGet},
+	"adguard":    {URL: "https://dns.adguard-dns.com/dns-query", Protocol: ProtocolWire, Method: http.MethodGet},
+}
+
+// NewRegistry returns a registry containing the built-in providers.
+func NewRegistry() *Registry {
+	return &Registry{providers: maps.Clone(builtinProviders)}
+}
+
+// Add registers p under name, replacing any provider with the same name.
+func (r *Registry) Add(name string, p Provider) error {
+	if name == "" {
+		return errors.New("provider name must not be empty")
+	}
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("provider %s: %w", name, err)
+	}
+	r.providers[name] = p
+	return nil
+}
+
+// Get returns the provider registered under name.
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return Provider{}, fmt.Errorf("unknown provider: %s (valid providers: %s)", name, strings.Join(r.Names(), ", "))
+	}
+	return p, nil
+}
+
+// Names returns the sorted names of all registered providers.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// configFile is the on-disk layout of the doh configuration file.
+type configFile struct {
+	Providers map[string]Provider `yaml:"providers"`
+}
+
+// LoadFile adds the providers declared in a YAML configuration file.
+func (r *Registry) LoadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config error: %w", err)
+	}
+
+	var cfg configFile
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return fmt.Errorf("parse config error: %s: %w", path, err)
+	}
+	for name, p := range cfg.Providers {
+		if err := r.Add(name, p); err != nil {
+			return fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// DoH providers known to the client
+var providers = NewRegistry()
+
+// DefaultProvider is the default DoH provider
+const DefaultProvider = "cloudflare"
+
+// DefaultConfigPath returns the location of the user configuration file,
+// e.g. ~/.config/doh/config.yaml on Linux.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "doh", "config.yaml"), nil
+}
+
+// LoadConfig adds the providers declared in the configuration file at path
+// to the set used by GetProvider and ValidProviders.
+func LoadConfig(path string) error {
+	return providers.LoadFile(path)
+}
+
+// ValidProviders returns a sorted list of valid provider names
+func ValidProviders() []string {
+	return providers.Names()
+}
+
+// GetProvider returns the provider registered under the given name
+func GetProvider(name string) (Provider, error) {
+	return providers.Get(name)
+}
+
+// LookupProvider returns the provider registered under name, or parses name
+// with ParseProviderURL when it is an endpoint URL.
+func LookupProvider(name string) (Provider, error) {
+	if strings.Contains(name, "://") {
+		return ParseProviderURL(name)
+	}
+	return GetProvider(name)
+}
+
+// GetProviderURL returns the DoH URL for the given provider
+func GetProviderURL(provider string) (string, error) {
+	p, err := GetProvider(provider)
+	if err != nil {
+		return "", err
+	}
+	return p.URL, nil
+}
+
+// ParseProviderURL builds an ad-hoc provider from an endpoint URL. HTTPS
+// endpoints are assumed to speak RFC 8484 wire format and h3:// endpoints
+// the same over HTTP/3. tls:// and quic:// use DNS over TLS and DNS over
+// QUIC, odoh:// is an Oblivious DoH target, and udp:// and tcp:// plain DNS.
+// JSON API endpoints have to be declared in the configuration file.
+func ParseProviderURL(raw string) (Provider, error) {
+	p := Provider{URL: raw, Protocol: ProtocolWire, Method: http.MethodGet}
+	if u, err := url.Parse(raw); err == nil {
+		switch u.Scheme {
+		case "tls":
+			p = Provider{URL: raw, Protocol: ProtocolDoT}
+		case "quic":
+			p = Provider{URL: raw, Protocol: ProtocolDoQ}
+		case "odoh":
+			u.Scheme = "https"
+			p = Provider{URL: u.String(), Protocol: ProtocolODoH}
+		case "udp":
+			p = Provider{URL: raw, Protocol: ProtocolUDP}
+		case "tcp":
+			p = Provider{URL: raw, Protocol: ProtocolTCP}
+		case "h3":
+			u.Scheme = "https"
+			p.URL = u.String()
+			p.HTTP3 = true
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return Provider{}, err
+	}
+	return p, nil
+}
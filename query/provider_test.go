@@ -0,0 +1,117 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestRegistryLoadFile(t *testing.T) {
+	path := writeConfig(t, `
+providers:
+  inhouse:
+    url: https://doh.internal.example/dns-query
+    protocol: wire
+    method: POST
+    headers:
+      Authorization: Bearer token
+  google:
+    url: https://dns.google/dns-query
+    protocol: wire
+`)
+
+	registry := NewRegistry()
+	if err := registry.LoadFile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p, err := registry.Get("inhouse")
+	if err != nil {
+		t.Fatalf("expected inhouse provider: %v", err)
+	}
+	if p.Protocol != ProtocolWire || p.Method != http.MethodPost || p.Headers["Authorization"] != "Bearer token" {
+		t.Fatalf("unexpected provider: %+v", p)
+	}
+	if google, _ := registry.Get("google"); google.Protocol != ProtocolWire {
+		t.Fatalf("expected config to override built-in provider, got %+v", google)
+	}
+	if names := registry.Names(); !slices.IsSorted(names) || !slices.Contains(names, "cloudflare") || !slices.Contains(names, "inhouse") {
+		t.Fatalf("unexpected provider names: %v", names)
+	}
+	if _, err := NewRegistry().Get("inhouse"); err == nil {
+		t.Fatal("expected loading a file to leave other registries untouched")
+	}
+}
+
+func TestRegistryLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "syntax", content: "providers: [", want: "parse config error"},
+		{name: "protocol", content: "providers:\n  bad:\n    url: https://example.com\n    protocol: smtp\n", want: `unknown protocol "smtp"`},
+		{name: "scheme", content: "providers:\n  bad:\n    url: ftp://example.com\n    protocol: wire\n", want: "scheme must be https or http"},
+		{name: "method", content: "providers:\n  bad:\n    url: https://example.com\n    protocol: json\n    method: POST\n", want: "unsupported method POST for json protocol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewRegistry().LoadFile(writeConfig(t, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("unexpected error; got %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	if err := NewRegistry().LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("expected error for missing config file")
+	}
+}
+
+func TestParseProviderURL(t *testing.T) {
+	p, err := ParseProviderURL("https://dns.example/dns-query")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Protocol != ProtocolWire || p.URL != "https://dns.example/dns-query" {
+		t.Fatalf("unexpected provider: %+v", p)
+	}
+
+	if _, err := ParseProviderURL("dns.example"); err == nil {
+		t.Fatal("expected error for URL without scheme")
+	}
+}
+
+func TestProviderHeadersAreSent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("X-Api-Key"), "secret"; got != want {
+			t.Errorf("unexpected X-Api-Key header; got %q, want %q", got, want)
+		}
+		_, _ = w.Write([]byte(`{"Status":0}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProvider(Provider{
+		URL:      srv.URL,
+		Protocol: ProtocolJSON,
+		Headers:  map[string]string{"X-Api-Key": "secret"},
+	}))
+	if _, err := client.Query(context.Background(), "example.com", "A"); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+}
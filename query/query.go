@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -29,6 +28,10 @@ type dohResponse struct {
 	Authority  []dohRecord     `json:"Authority"`
 	Additional []dohRecord     `json:"Additional"`
 	Comment    responseComment `json:"Comment"`
+	// EDNSClientSubnet is "address/source" or "address/source/scope".
+	EDNSClientSubnet string `json:"edns_client_subnet"`
+	// wire is the raw message of a wire-format response.
+	wire []byte
 }
 
 type dohRecord struct {
@@ -59,15 +62,25 @@ func (c *responseComment) UnmarshalJSON(data []byte) error {
 
 // JSONOutput represents the output structure for JSON format
 type JSONOutput struct {
-	Status     int           `json:"status"`
-	StatusName string        `json:"status_name"`
-	Flags      DNSFlags      `json:"flags"`
-	Question   []DNSQuestion `json:"question,omitempty"`
-	Records    []DNSRecord   `json:"records,omitempty"`
-	Authority  []DNSRecord   `json:"authority,omitempty"`
-	Additional []DNSRecord   `json:"additional,omitempty"`
-	Comments   []string      `json:"comments,omitempty"`
-	Error      string        `json:"error,omitempty"`
+	Status       int            `json:"status"`
+	StatusName   string         `json:"status_name"`
+	Flags        DNSFlags       `json:"flags"`
+	Question     []DNSQuestion  `json:"question,omitempty"`
+	Records      []DNSRecord    `json:"records,omitempty"`
+	Authority    []DNSRecord    `json:"authority,omitempty"`
+	Additional   []DNSRecord    `json:"additional,omitempty"`
+	Comments     []string       `json:"comments,omitempty"`
+	FCrDNS       []FCrDNSResult `json:"fcrdns,omitempty"`
+	ClientSubnet *ClientSubnet  `json:"client_subnet,omitempty"`
+	Trace        *Trace         `json:"trace,omitempty"`
+	Timing       *Timing        `json:"timing,omitempty"`
+	// Provider is the URL of the provider that answered, set when the
+	// client has failover or racing providers.
+	Provider string `json:"provider,omitempty"`
+	// Latency is the time the winning provider of a race took to answer,
+	// in milliseconds.
+	Latency float64 `json:"latency_ms,omitempty"`
+	Error   string  `json:"error,omitempty"`
 }
 
 // DNSQuestion represents the question section of a DNS response.
@@ -93,36 +106,10 @@ type DNSRecord struct {
 	TypeName string `json:"type_name"`
 	TTL      int    `json:"ttl"`
 	Data     string `json:"data"`
+	Parsed   any    `json:"parsed,omitempty"`
 	Whois    string `json:"whois,omitempty"`
 }
 
-// Provider URLs for DNS-over-HTTPS
-var providerURLs = map[string]string{
-	"cloudflare": "https://cloudflare-dns.com/dns-query",
-	"google":     "https://dns.google/resolve",
-}
-
-// DefaultProvider is the default DoH provider
-const DefaultProvider = "cloudflare"
-
-// ValidProviders returns a list of valid provider names
-func ValidProviders() []string {
-	providers := make([]string, 0, len(providerURLs))
-	for p := range providerURLs {
-		providers = append(providers, p)
-	}
-	return providers
-}
-
-// GetProviderURL returns the DoH URL for the given provider
-func GetProviderURL(provider string) (string, error) {
-	url, ok := providerURLs[provider]
-	if !ok {
-		return "", fmt.Errorf("unknown provider: %s (valid providers: cloudflare, google)", provider)
-	}
-	return url, nil
-}
-
 // DNS record types that contain IP addresses suitable for WHOIS lookup
 var ipRecordTypes = map[int]bool{
 	1:  true, // A record
@@ -298,6 +285,7 @@ func makeDNSRecord(r dohRecord, enableWhois bool) DNSRecord {
 		TypeName: dnsTypeName(r.Type),
 		TTL:      r.TTL,
 		Data:     r.Data,
+		Parsed:   parseRData(r.Type, r.Data),
 	}
 	if enableWhois && ipRecordTypes[r.Type] {
 		if whoisResult, err := Whois(r.Data); err == nil && whoisResult != "" {
@@ -338,11 +326,12 @@ func makeJSONOutput(res dohResponse, enableWhois bool) JSONOutput {
 			AuthenticData:      res.Ad,
 			CheckingDisabled:   res.Cd,
 		},
-		Question:   questions,
-		Records:    makeDNSRecords(res.Answer, enableWhois),
-		Authority:  makeDNSRecords(res.Authority, false),
-		Additional: makeDNSRecords(res.Additional, false),
-		Comments:   []string(res.Comment),
+		Question:     questions,
+		Records:      groupSignatures(makeDNSRecords(res.Answer, enableWhois)),
+		Authority:    groupSignatures(makeDNSRecords(res.Authority, false)),
+		Additional:   groupSignatures(makeDNSRecords(res.Additional, false)),
+		Comments:     []string(res.Comment),
+		ClientSubnet: parseClientSubnet(res.EDNSClientSubnet),
 	}
 }
 
@@ -353,56 +342,84 @@ func rcodeName(code int) string {
 	return "UNKNOWN"
 }
 
-func Do(queryType string, domain string, enableWhois bool, enableJSON bool, provider string) error {
-	dohURL, err := GetProviderURL(provider)
-	if err != nil {
-		return err
+// Do resolves domain through provider, a provider name or endpoint URL as
+// accepted by LookupProvider, and prints the response in text or JSON form.
+// queryType may list several types ("a,aaaa,mx") or name a preset ("all");
+// those are resolved in parallel and grouped by type. Options are applied
+// after the provider, so WithProvider overrides it. Do is the CLI entry point; library users should
+// use Client.Query instead.
+func Do(queryType string, domain string, enableWhois bool, enableJSON bool, provider string, opts ...Option) error {
+	format := FormatText
+	if enableJSON {
+		format = FormatJSON
 	}
-	url := fmt.Sprintf("%s?name=%s&type=%s", dohURL, domain, queryType)
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	return DoFormat(queryType, domain, enableWhois, format, provider, opts...)
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// DoFormat is like Do but prints the response in the given output format.
+func DoFormat(queryType string, domain string, enableWhois bool, format string, provider string, opts ...Option) error {
+	formatter, err := GetFormatter(format)
 	if err != nil {
-		return fmt.Errorf("new request error: %w", err)
+		return err
 	}
+	return DoFormatter(queryType, domain, enableWhois, formatter, provider, opts...)
+}
 
-	req.Header.Set("accept", "application/dns-json")
-
-	response, err := http.DefaultClient.Do(req)
+// DoFormatter is like DoFormat but prints the response with formatter, such
+// as one returned by NewTemplateFormatter.
+func DoFormatter(queryType string, domain string, enableWhois bool, formatter Formatter, provider string, opts ...Option) error {
+	p, err := LookupProvider(provider)
 	if err != nil {
-		return fmt.Errorf("request do error: %w", err)
+		return err
 	}
+
+	client := NewClient(append([]Option{WithProvider(p), WithWhois(enableWhois)}, opts...)...)
 	defer func() {
-		if err := response.Body.Close(); err != nil {
-			fmt.Printf("failed to close response body: %v\n", err)
-		}
+		_ = client.Close()
 	}()
+	if IsMultiType(queryType) {
+		return doMulti(client, queryType, domain, formatter)
+	}
 
-	content, err := io.ReadAll(response.Body)
+	output, err := client.Query(context.Background(), domain, queryType)
 	if err != nil {
-		return fmt.Errorf("read body error: %w", err)
+		return err
 	}
+	return formatter([]QueryOutput{{JSONOutput: *output}})
+}
 
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("error response status: %s, body: %s", response.Status, string(content))
+// queryJSON resolves domain using the application/dns-json API.
+func (c *Client) queryJSON(ctx context.Context, domain, queryType string) (dohResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.provider.URL, nil)
+	if err != nil {
+		return dohResponse{}, fmt.Errorf("new request error: %w", err)
 	}
-
-	var res dohResponse
-	if err := json.Unmarshal(content, &res); err != nil {
-		return fmt.Errorf("unmarshal error: %w", err)
+	params := req.URL.Query()
+	params.Set("name", domain)
+	params.Set("type", queryType)
+	if c.request.clientSubnet.IsValid() {
+		params.Set("edns_client_subnet", c.request.clientSubnet.String())
 	}
+	if c.request.dnssec {
+		params.Set("do", "1")
+	}
+	if c.request.checkingDisabled {
+		params.Set("cd", "1")
+	}
+	req.URL.RawQuery = params.Encode()
 
-	output := makeJSONOutput(res, enableWhois)
-	if res.Status != 0 {
-		return RcodeError{Code: res.Status, Response: output}
+	req.Header.Set("accept", "application/dns-json")
+
+	content, err := c.doRequest(req)
+	if err != nil {
+		return dohResponse{}, err
 	}
 
-	if enableJSON {
-		return outputJSON(output)
+	var res dohResponse
+	if err := json.Unmarshal(content, &res); err != nil {
+		return dohResponse{}, fmt.Errorf("unmarshal error: %w", err)
 	}
-	return outputText(output)
+	return res, nil
 }
 
 // OutputTextResponse prints a parsed DNS response in human-readable form.
@@ -433,6 +450,21 @@ func outputText(output JSONOutput) error {
 	for _, comment := range output.Comments {
 		fmt.Printf("%s: %v\n", blue("comment"), green(comment))
 	}
+	for _, r := range output.FCrDNS {
+		fmt.Printf("%s: %v %v\n", blue("fcrdns"), green(r.Hostname), fcrdnsStatus(r))
+	}
+	if output.ClientSubnet != nil {
+		fmt.Printf("%s: %v\n", blue("client subnet"), green(output.ClientSubnet))
+	}
+	if output.Provider != "" {
+		fmt.Printf("%s: %v\n", blue("provider"), green(output.Provider))
+	}
+	if output.Latency > 0 {
+		fmt.Printf("%s: %v\n", blue("latency"), green(fmt.Sprintf("%.1fms", output.Latency)))
+	}
+	if output.Trace != nil {
+		printTrace(output)
+	}
 	return nil
 }
 
@@ -445,6 +477,11 @@ func printRecords(records []DNSRecord, blue, green func(a ...interface{}) string
 		fmt.Printf("%s: %v\n", blue("type"), green(fmt.Sprintf("%d (%s)", r.Type, r.TypeName)))
 		fmt.Printf("%s: %v\n", blue("ttl"), green(r.TTL))
 		fmt.Printf("%s: %v\n", blue("data"), green(r.Data))
+		if parsed, ok := r.Parsed.(parsedRData); ok {
+			for _, f := range parsed.fields() {
+				fmt.Printf("  %s: %v\n", blue(f.name), green(f.value))
+			}
+		}
 		if r.Whois != "" {
 			fmt.Printf("%s: %v\n", blue("whois"), green(r.Whois))
 		}
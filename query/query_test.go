@@ -31,24 +31,36 @@ func (errorReadCloser) Close() error {
 
 func captureStdout(t *testing.T, fn func()) string {
 	t.Helper()
+	return captureFile(t, &os.Stdout, fn)
+}
+
+func captureStderr(t *testing.T, fn func()) string {
+	t.Helper()
+	return captureFile(t, &os.Stderr, fn)
+}
 
-	oldStdout := os.Stdout
+// captureFile returns what fn writes to *file, which it replaces by a pipe
+// while fn runs.
+func captureFile(t *testing.T, file **os.File, fn func()) string {
+	t.Helper()
+
+	old := *file
 	r, w, err := os.Pipe()
 	if err != nil {
 		t.Fatalf("failed to create pipe: %v", err)
 	}
-	os.Stdout = w
+	*file = w
 
 	fn()
 
 	if err := w.Close(); err != nil {
 		t.Fatalf("failed to close write pipe: %v", err)
 	}
-	os.Stdout = oldStdout
+	*file = old
 
 	var buf bytes.Buffer
 	if _, err := io.Copy(&buf, r); err != nil {
-		t.Fatalf("failed to read captured stdout: %v", err)
+		t.Fatalf("failed to read captured output: %v", err)
 	}
 	if err := r.Close(); err != nil {
 		t.Fatalf("failed to close read pipe: %v", err)
@@ -166,24 +178,6 @@ func TestOutputJSONErrorForTransportError(t *testing.T) {
 	}
 }
 
-func addTestProvider(t *testing.T, url string) string {
-	t.Helper()
-
-	const providerName = "test-provider"
-	oldURL, existed := providerURLs[providerName]
-	providerURLs[providerName] = url
-
-	t.Cleanup(func() {
-		if existed {
-			providerURLs[providerName] = oldURL
-			return
-		}
-		delete(providerURLs, providerName)
-	})
-
-	return providerName
-}
-
 func TestDoReturnsRcodeError(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/dns-json")
@@ -191,8 +185,8 @@ func TestDoReturnsRcodeError(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
-	err := Do("a", "example.com", false, false, provider)
+	provider := WithProviderURL(srv.URL)
+	err := Do("a", "example.com", false, false, DefaultProvider, provider)
 	if err == nil {
 		t.Fatalf("expected rcode error")
 	}
@@ -225,9 +219,9 @@ func TestDoBuildsProviderRequest(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
+	provider := WithProviderURL(srv.URL)
 	_ = captureStdout(t, func() {
-		if err := Do("HTTPS", "example.com", false, false, provider); err != nil {
+		if err := Do("HTTPS", "example.com", false, false, DefaultProvider, provider); err != nil {
 			t.Fatalf("expected nil error, got %v", err)
 		}
 	})
@@ -270,8 +264,8 @@ func TestDoNon200Response(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
-	err := Do("a", "example.com", false, false, provider)
+	provider := WithProviderURL(srv.URL)
+	err := Do("a", "example.com", false, false, DefaultProvider, provider)
 	if err == nil {
 		t.Fatalf("expected non-200 error")
 	}
@@ -287,8 +281,8 @@ func TestDoInvalidJSON(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
-	err := Do("a", "example.com", false, false, provider)
+	provider := WithProviderURL(srv.URL)
+	err := Do("a", "example.com", false, false, DefaultProvider, provider)
 	if err == nil {
 		t.Fatalf("expected unmarshal error")
 	}
@@ -298,8 +292,8 @@ func TestDoInvalidJSON(t *testing.T) {
 }
 
 func TestDoNewRequestError(t *testing.T) {
-	provider := addTestProvider(t, "://bad-url")
-	err := Do("a", "example.com", false, false, provider)
+	provider := WithProviderURL("://bad-url")
+	err := Do("a", "example.com", false, false, DefaultProvider, provider)
 	if err == nil {
 		t.Fatalf("expected new request error")
 	}
@@ -315,9 +309,9 @@ func TestDoNoAnswerTextOutput(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
+	provider := WithProviderURL(srv.URL)
 	out := captureStdout(t, func() {
-		err := Do("a", "example.com", false, false, provider)
+		err := Do("a", "example.com", false, false, DefaultProvider, provider)
 		if err != nil {
 			t.Fatalf("expected nil error, got %v", err)
 		}
@@ -335,9 +329,9 @@ func TestDoNoAnswerJSONOutput(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
+	provider := WithProviderURL(srv.URL)
 	out := captureStdout(t, func() {
-		err := Do("a", "example.com", false, true, provider)
+		err := Do("a", "example.com", false, true, DefaultProvider, provider)
 		if err != nil {
 			t.Fatalf("expected nil error, got %v", err)
 		}
@@ -359,9 +353,9 @@ func TestDoSuccessJSONOutput(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
+	provider := WithProviderURL(srv.URL)
 	out := captureStdout(t, func() {
-		err := Do("a", "example.com", false, true, provider)
+		err := Do("a", "example.com", false, true, DefaultProvider, provider)
 		if err != nil {
 			t.Fatalf("expected nil error, got %v", err)
 		}
@@ -390,9 +384,9 @@ func TestDoSuccessTextOutput(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
+	provider := WithProviderURL(srv.URL)
 	out := captureStdout(t, func() {
-		err := Do("a", "example.com", false, false, provider)
+		err := Do("a", "example.com", false, false, DefaultProvider, provider)
 		if err != nil {
 			t.Fatalf("expected nil error, got %v", err)
 		}
@@ -422,9 +416,9 @@ func TestTextOutputSeparatesMultipleAnswerRecords(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
+	provider := WithProviderURL(srv.URL)
 	out := captureStdout(t, func() {
-		if err := Do("A", "example.com", false, false, provider); err != nil {
+		if err := Do("A", "example.com", false, false, DefaultProvider, provider); err != nil {
 			t.Fatalf("expected nil error, got %v", err)
 		}
 	})
@@ -453,9 +447,9 @@ func TestDoOutputsAllResponseSections(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	provider := addTestProvider(t, srv.URL)
+	provider := WithProviderURL(srv.URL)
 	out := captureStdout(t, func() {
-		if err := Do("mx", "example.com", false, true, provider); err != nil {
+		if err := Do("mx", "example.com", false, true, DefaultProvider, provider); err != nil {
 			t.Fatalf("expected nil error, got %v", err)
 		}
 	})
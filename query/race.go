@@ -0,0 +1,94 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WithRace sends every query to the client's provider and to providers at
+// the same time and returns the first answer, cancelling the other
+// queries. SERVFAIL and REFUSED answers only win when no provider gives a
+// better one. Responses report the winning provider and its latency in
+// JSONOutput.Provider and JSONOutput.Latency.
+func WithRace(providers ...Provider) Option {
+	return func(c *Client) {
+		c.race = providers
+	}
+}
+
+// raceResult is the outcome of one query of a race.
+type raceResult struct {
+	res      dohResponse
+	provider Provider
+	elapsed  time.Duration
+	err      error
+	// timing records the query of this racer when timing is enabled.
+	timing *timingRecorder
+}
+
+// lookupRace queries the provider of c, including its failover providers,
+// and the racing providers concurrently and returns the first answer. Every
+// racer is timed on its own, and only the timing of the winner is kept.
+func (c *Client) lookupRace(ctx context.Context, name, queryType string) (dohResponse, Provider, time.Duration, error) {
+	rec := timingFrom(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	racer := func(provider Provider) (context.Context, raceResult) {
+		r := raceResult{provider: provider}
+		if rec == nil {
+			return ctx, r
+		}
+		var racerCtx context.Context
+		racerCtx, r.timing = withTiming(ctx)
+		return racerCtx, r
+	}
+
+	start := time.Now()
+	results := make(chan raceResult, 1+len(c.racers))
+	go func() {
+		racerCtx, r := racer(c.provider)
+		var answered Provider
+		r.res, answered, r.err = c.lookupFailover(racerCtx, name, queryType)
+		if r.err == nil {
+			r.provider = answered
+		}
+		r.elapsed = time.Since(start)
+		results <- r
+	}()
+	for _, rc := range c.racers {
+		go func() {
+			racerCtx, r := racer(rc.provider)
+			r.res, r.err = rc.lookup(racerCtx, name, queryType)
+			r.elapsed = time.Since(start)
+			results <- r
+		}()
+	}
+
+	var fallback *raceResult
+	var errs []error
+	for range 1 + len(c.racers) {
+		r := <-results
+		switch {
+		case r.err != nil:
+			errs = append(errs, fmt.Errorf("%s: %w", r.provider.URL, r.err))
+		case r.res.Status == 2 || r.res.Status == 5:
+			if fallback == nil {
+				fallback = &r
+			}
+		default:
+			if rec != nil {
+				rec.keep(r.timing)
+			}
+			return r.res, r.provider, r.elapsed, nil
+		}
+	}
+	if fallback != nil {
+		if rec != nil {
+			rec.keep(fallback.timing)
+		}
+		return fallback.res, fallback.provider, fallback.elapsed, nil
+	}
+	return dohResponse{}, Provider{}, 0, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
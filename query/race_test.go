@@ -0,0 +1,161 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func jsonServer(t *testing.T, delay time.Duration, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+const raceAnswer = `{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":300,"data":"192.0.2.1"}]}`
+
+func TestClientRace(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer slow.Close()
+	fast := jsonServer(t, 0, raceAnswer)
+
+	client := NewClient(WithProviderURL(slow.URL), WithRace(Provider{URL: fast.URL, Protocol: ProtocolJSON}))
+	defer func() {
+		_ = client.Close()
+	}()
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.Provider != fast.URL || output.Latency <= 0 || len(output.Records) != 1 {
+		t.Fatalf("unexpected output: %+v", output)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("losing query was not cancelled")
+	}
+}
+
+func TestClientRaceServFail(t *testing.T) {
+	servfail := jsonServer(t, 0, `{"Status":2}`)
+	ok := jsonServer(t, 20*time.Millisecond, raceAnswer)
+
+	client := NewClient(WithProviderURL(servfail.URL), WithRace(Provider{URL: ok.URL, Protocol: ProtocolJSON}))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil || output.Provider != ok.URL {
+		t.Fatalf("unexpected result %+v: %v", output, err)
+	}
+
+	client = NewClient(WithProviderURL(servfail.URL), WithRace(Provider{URL: "http://127.0.0.1:1", Protocol: ProtocolJSON}))
+	output, err = client.Query(context.Background(), "example.com", "A")
+	if err == nil || output == nil || output.Status != 2 || output.Provider != servfail.URL {
+		t.Fatalf("expected SERVFAIL answer, got %+v: %v", output, err)
+	}
+}
+
+func TestClientRaceAllFail(t *testing.T) {
+	client := NewClient(WithProviderURL("http://127.0.0.1:1"), WithRace(Provider{URL: "http://127.0.0.1:2", Protocol: ProtocolJSON}))
+	_, err := client.Query(context.Background(), "example.com", "A")
+	if err == nil || !strings.Contains(err.Error(), "all providers failed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestClientRaceTiming(t *testing.T) {
+	// The losing provider completes a TLS handshake and sends its headers
+	// before the winner answers over plain HTTP.
+	loser := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server", "loser")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer loser.Close()
+	winner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("X-Server", "winner")
+		_, _ = w.Write([]byte(raceAnswer))
+	}))
+	defer winner.Close()
+
+	client := NewClient(WithProviderURL(loser.URL), WithHTTPClient(loser.Client()), WithVerbose(true),
+		WithRace(Provider{URL: winner.URL, Protocol: ProtocolJSON}))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	timing := output.Timing
+	if output.Provider != winner.URL || timing == nil {
+		t.Fatalf("unexpected output: %+v", output)
+	}
+	if timing.Headers["X-Server"] != "winner" || timing.TLSVersion != "" || timing.TLSHandshake != 0 || timing.FirstByte < 50 {
+		t.Fatalf("unexpected timing: %+v", timing)
+	}
+
+	// Both providers answer SERVFAIL; the first answer is returned with its
+	// own timing although the other one finishes later.
+	first := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Server", "first")
+		_, _ = w.Write([]byte(`{"Status":2}`))
+	}))
+	defer first.Close()
+	second := jsonServer(t, 50*time.Millisecond, `{"Status":2}`)
+
+	client = NewClient(WithProvider(Provider{URL: first.URL, Protocol: ProtocolJSON}), WithHTTPClient(first.Client()), WithVerbose(true),
+		WithRace(Provider{URL: second.URL, Protocol: ProtocolJSON}))
+	output, err = client.Query(context.Background(), "example.com", "A")
+	if err == nil || output == nil || output.Provider != first.URL {
+		t.Fatalf("expected SERVFAIL answer, got %+v: %v", output, err)
+	}
+	if timing := output.Timing; timing.Headers["X-Server"] != "first" || timing.TLSVersion == "" {
+		t.Fatalf("unexpected timing: %+v", timing)
+	}
+}
+
+func TestCompareIgnoresRace(t *testing.T) {
+	slowAnswer := func(addr [4]byte) func(t *testing.T, q dnsmessage.Message) []byte {
+		return func(t *testing.T, q dnsmessage.Message) []byte {
+			time.Sleep(20 * time.Millisecond)
+			return packResponse(t, dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: q.ID, RecursionAvailable: true},
+				Questions: q.Questions,
+				Answers: []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: addr},
+				}},
+			})
+		}
+	}
+	a := newWireServer(t, http.MethodGet, slowAnswer([4]byte{192, 0, 2, 1}))
+	b := newWireServer(t, http.MethodGet, slowAnswer([4]byte{192, 0, 2, 2}))
+	fast := jsonServer(t, 0, `{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":300,"data":"198.51.100.1"}]}`)
+
+	cmp, err := Compare(context.Background(), []string{a.URL, b.URL}, "example.com", "A",
+		WithRace(Provider{URL: fast.URL, Protocol: ProtocolJSON}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cmp.Results[0].Answers) != 1 || cmp.Results[0].Answers[0] != "example.com A 192.0.2.1" ||
+		len(cmp.Results[1].Answers) != 1 || cmp.Results[1].Answers[0] != "example.com A 192.0.2.2" {
+		t.Fatalf("rows do not show the answers of their providers: %+v", cmp.Results)
+	}
+}
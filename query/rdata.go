@@ -0,0 +1,383 @@
+package query
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var errShortRData = errors.New("rdata too short")
+
+// base32HexNoPad is the NSEC3 owner hash encoding (RFC 5155 section 3.3).
+var base32HexNoPad = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// formatRData renders a resource body in zone-file presentation format, the
+// same format the JSON APIs use for the "data" field.
+func formatRData(body dnsmessage.ResourceBody) string {
+	switch b := body.(type) {
+	case *dnsmessage.AResource:
+		return netip.AddrFrom4(b.A).String()
+	case *dnsmessage.AAAAResource:
+		return netip.AddrFrom16(b.AAAA).String()
+	case *dnsmessage.NSResource:
+		return b.NS.String()
+	case *dnsmessage.CNAMEResource:
+		return b.CNAME.String()
+	case *dnsmessage.PTRResource:
+		return b.PTR.String()
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", b.Pref, b.MX.String())
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", b.NS.String(), b.MBox.String(),
+			b.Serial, b.Refresh, b.Retry, b.Expire, b.MinTTL)
+	case *dnsmessage.TXTResource:
+		return quoteCharacterStrings(b.TXT)
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", b.Priority, b.Weight, b.Port, b.Target.String())
+	case *dnsmessage.SVCBResource:
+		return formatSVCB(*b)
+	case *dnsmessage.HTTPSResource:
+		return formatSVCB(b.SVCBResource)
+	case *dnsmessage.UnknownResource:
+		if s, err := formatRawRData(uint16(b.Type), b.Data); err == nil {
+			return s
+		}
+		return formatGenericRData(b.Data)
+	}
+	return ""
+}
+
+// formatRawRData renders the record types that dnsmessage leaves undecoded.
+func formatRawRData(rrtype uint16, data []byte) (string, error) {
+	r := rdataReader{data: data}
+	var s string
+	switch rrtype {
+	case 39: // DNAME
+		s = r.name()
+	case 13: // HINFO
+		s = quoteCharacterStrings([]string{r.characterString(), r.characterString()})
+	case 16, 99: // TXT, SPF
+		var parts []string
+		for r.err == nil && r.remaining() > 0 {
+			parts = append(parts, r.characterString())
+		}
+		s = quoteCharacterStrings(parts)
+	case 35: // NAPTR
+		order, pref := r.uint16(), r.uint16()
+		flags, services, regexp := r.characterString(), r.characterString(), r.characterString()
+		s = fmt.Sprintf("%d %d %s %s", order, pref,
+			quoteCharacterStrings([]string{flags, services, regexp}), r.name())
+	case 43, 59, 32769: // DS, CDS, DLV
+		keyTag, alg, digestType := r.uint16(), r.uint8(), r.uint8()
+		s = fmt.Sprintf("%d %d %d %s", keyTag, alg, digestType, strings.ToUpper(hex.EncodeToString(r.rest())))
+	case 25, 48, 60: // KEY, DNSKEY, CDNSKEY
+		flags, proto, alg := r.uint16(), r.uint8(), r.uint8()
+		s = fmt.Sprintf("%d %d %d %s", flags, proto, alg, base64.StdEncoding.EncodeToString(r.rest()))
+	case 24, 46: // SIG, RRSIG
+		covered, alg, labels := r.uint16(), r.uint8(), r.uint8()
+		origTTL, expiration, inception := r.uint32(), r.uint32(), r.uint32()
+		keyTag, signer := r.uint16(), r.name()
+		s = fmt.Sprintf("%s %d %d %d %s %s %d %s %s", dnsTypeName(int(covered)), alg, labels, origTTL,
+			formatSignatureTime(expiration), formatSignatureTime(inception), keyTag, signer,
+			base64.StdEncoding.EncodeToString(r.rest()))
+	case 47: // NSEC
+		next := r.name()
+		s = strings.TrimSpace(next + " " + formatTypeBitmap(r.rest()))
+	case 50: // NSEC3
+		hashAlg, flags, iterations := r.uint8(), r.uint8(), r.uint16()
+		salt := r.bytes(int(r.uint8()))
+		nextHash := r.bytes(int(r.uint8()))
+		s = strings.TrimSpace(fmt.Sprintf("%d %d %d %s %s %s", hashAlg, flags, iterations, formatSalt(salt),
+			base32HexNoPad.EncodeToString(nextHash), formatTypeBitmap(r.rest())))
+	case 51: // NSEC3PARAM
+		hashAlg, flags, iterations := r.uint8(), r.uint8(), r.uint16()
+		salt := r.bytes(int(r.uint8()))
+		s = fmt.Sprintf("%d %d %d %s", hashAlg, flags, iterations, formatSalt(salt))
+	case 44: // SSHFP
+		alg, fpType := r.uint8(), r.uint8()
+		s = fmt.Sprintf("%d %d %s", alg, fpType, strings.ToUpper(hex.EncodeToString(r.rest())))
+	case 52, 53: // TLSA, SMIMEA
+		usage, selector, matching := r.uint8(), r.uint8(), r.uint8()
+		s = fmt.Sprintf("%d %d %d %s", usage, selector, matching, strings.ToUpper(hex.EncodeToString(r.rest())))
+	case 256: // URI
+		priority, weight := r.uint16(), r.uint16()
+		s = fmt.Sprintf("%d %d %s", priority, weight, quoteCharacterStrings([]string{string(r.rest())}))
+	case 257: // CAA
+		flags := r.uint8()
+		tag := string(r.bytes(int(r.uint8())))
+		s = fmt.Sprintf("%d %s %s", flags, tag, quoteCharacterStrings([]string{string(r.rest())}))
+	default:
+		return "", fmt.Errorf("no presentation format for type %d", rrtype)
+	}
+	if r.err != nil {
+		return "", r.err
+	}
+	return s, nil
+}
+
+// formatGenericRData renders rdata using the RFC 3597 unknown type notation.
+func formatGenericRData(data []byte) string {
+	if len(data) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(data), strings.ToUpper(hex.EncodeToString(data)))
+}
+
+var svcParamNames = map[dnsmessage.SVCParamKey]string{
+	dnsmessage.SVCParamMandatory:     "mandatory",
+	dnsmessage.SVCParamALPN:          "alpn",
+	dnsmessage.SVCParamNoDefaultALPN: "no-default-alpn",
+	dnsmessage.SVCParamPort:          "port",
+	dnsmessage.SVCParamIPv4Hint:      "ipv4hint",
+	dnsmessage.SVCParamECH:           "ech",
+	dnsmessage.SVCParamIPv6Hint:      "ipv6hint",
+	dnsmessage.SVCParamDOHPath:       "dohpath",
+	dnsmessage.SVCParamOHTTP:         "ohttp",
+}
+
+func svcParamName(key dnsmessage.SVCParamKey) string {
+	if name, ok := svcParamNames[key]; ok {
+		return name
+	}
+	return "key" + strconv.Itoa(int(key))
+}
+
+func formatSVCB(r dnsmessage.SVCBResource) string {
+	parts := []string{strconv.Itoa(int(r.Priority)), r.Target.String()}
+	for _, param := range r.Params {
+		value, ok := formatSVCParamValue(param)
+		if !ok {
+			value = quoteCharacterStrings([]string{string(param.Value)})
+		}
+		if value == "" {
+			parts = append(parts, svcParamName(param.Key))
+			continue
+		}
+		parts = append(parts, svcParamName(param.Key)+"="+value)
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatSVCParamValue(param dnsmessage.SVCParam) (string, bool) {
+	v := param.Value
+	switch param.Key {
+	case dnsmessage.SVCParamMandatory:
+		if len(v)%2 != 0 {
+			return "", false
+		}
+		keys := make([]string, 0, len(v)/2)
+		for i := 0; i < len(v); i += 2 {
+			keys = append(keys, svcParamName(dnsmessage.SVCParamKey(binary.BigEndian.Uint16(v[i:]))))
+		}
+		return strings.Join(keys, ","), true
+	case dnsmessage.SVCParamALPN:
+		r := rdataReader{data: v}
+		var ids []string
+		for r.err == nil && r.remaining() > 0 {
+			ids = append(ids, r.characterString())
+		}
+		return strings.Join(ids, ","), r.err == nil
+	case dnsmessage.SVCParamNoDefaultALPN, dnsmessage.SVCParamOHTTP:
+		return "", len(v) == 0
+	case dnsmessage.SVCParamPort:
+		if len(v) != 2 {
+			return "", false
+		}
+		return strconv.Itoa(int(binary.BigEndian.Uint16(v))), true
+	case dnsmessage.SVCParamIPv4Hint, dnsmessage.SVCParamIPv6Hint:
+		size := 4
+		if param.Key == dnsmessage.SVCParamIPv6Hint {
+			size = 16
+		}
+		if len(v) == 0 || len(v)%size != 0 {
+			return "", false
+		}
+		addrs := make([]string, 0, len(v)/size)
+		for i := 0; i < len(v); i += size {
+			addr, _ := netip.AddrFromSlice(v[i : i+size])
+			addrs = append(addrs, addr.String())
+		}
+		return strings.Join(addrs, ","), true
+	case dnsmessage.SVCParamECH:
+		return base64.StdEncoding.EncodeToString(v), true
+	case dnsmessage.SVCParamDOHPath:
+		return string(v), true
+	}
+	return "", false
+}
+
+// formatTypeBitmap decodes an NSEC/NSEC3 type bit map (RFC 4034 section 4.1.2).
+func formatTypeBitmap(data []byte) string {
+	var types []string
+	for len(data) >= 2 {
+		window, length := int(data[0]), int(data[1])
+		data = data[2:]
+		if length > len(data) {
+			break
+		}
+		for i, b := range data[:length] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, dnsTypeName(window*256+i*8+bit))
+				}
+			}
+		}
+		data = data[length:]
+	}
+	return strings.Join(types, " ")
+}
+
+func formatSalt(salt []byte) string {
+	if len(salt) == 0 {
+		return "-"
+	}
+	return strings.ToUpper(hex.EncodeToString(salt))
+}
+
+// formatSignatureTime renders an RRSIG timestamp as YYYYMMDDHHmmSS.
+func formatSignatureTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
+
+// quoteCharacterStrings renders character-strings as quoted, escaped
+// presentation values separated by spaces.
+func quoteCharacterStrings(parts []string) string {
+	quoted := make([]string, 0, len(parts))
+	for _, part := range parts {
+		var b strings.Builder
+		b.WriteByte('"')
+		for i := 0; i < len(part); i++ {
+			c := part[i]
+			switch {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c < ' ' || c > '~':
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('"')
+		quoted = append(quoted, b.String())
+	}
+	return strings.Join(quoted, " ")
+}
+
+// rdataReader decodes the fixed-layout fields of raw rdata. The first
+// error is sticky so callers can check it once after reading all fields.
+type rdataReader struct {
+	data []byte
+	off  int
+	err  error
+}
+
+func (r *rdataReader) remaining() int {
+	return len(r.data) - r.off
+}
+
+func (r *rdataReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > r.remaining() {
+		r.err = errShortRData
+		return nil
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b
+}
+
+func (r *rdataReader) rest() []byte {
+	return r.bytes(r.remaining())
+}
+
+func (r *rdataReader) uint8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *rdataReader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *rdataReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *rdataReader) characterString() string {
+	return string(r.bytes(int(r.uint8())))
+}
+
+// name reads an uncompressed domain name. Record types newer than RFC 1035
+// may not use compression inside rdata (RFC 3597 section 4).
+func (r *rdataReader) name() string {
+	var b strings.Builder
+	for r.err == nil {
+		length := int(r.uint8())
+		if length == 0 {
+			break
+		}
+		if length&0xC0 != 0 {
+			r.err = errors.New("compressed name in rdata")
+			return ""
+		}
+		for _, c := range r.bytes(length) {
+			switch {
+			case c == '.' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c <= ' ' || c > '~':
+				fmt.Fprintf(&b, "\\%03d", c)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte('.')
+	}
+	if b.Len() == 0 {
+		return "."
+	}
+	return b.String()
+}
+
+// wireName reads an uncompressed domain name and returns it in wire format.
+func (r *rdataReader) wireName() []byte {
+	start := r.off
+	for r.err == nil {
+		length := int(r.uint8())
+		if length == 0 {
+			break
+		}
+		if length&0xC0 != 0 {
+			r.err = errors.New("compressed name in rdata")
+			return nil
+		}
+		r.bytes(length)
+	}
+	if r.err != nil {
+		return nil
+	}
+	return r.data[start:r.off]
+}
@@ -0,0 +1,119 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultRetryBackoff is the delay before the first retry of a query.
+const DefaultRetryBackoff = 200 * time.Millisecond
+
+// WithRetries retries a failed query up to n times when the error is
+// retryable: a timeout, HTTP 429 Too Many Requests or a 5xx status. The
+// delay before retry i is backoff*2^(i-1), randomized by up to half to
+// avoid retrying in lockstep.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.retryBackoff = backoff
+	}
+}
+
+// WithFailover sets providers that are tried in order when the query to
+// the primary provider fails, after its retries. DNS error rcodes are
+// answers and do not cause a failover. Responses report the provider that
+// answered in JSONOutput.Provider.
+func WithFailover(providers ...Provider) Option {
+	return func(c *Client) {
+		c.failover = providers
+	}
+}
+
+// soloProvider sets p as the provider of a client that has to answer on
+// its own, such as one row of Compare, dropping any WithFailover and
+// WithRace providers set by earlier options.
+func soloProvider(p Provider) Option {
+	return func(c *Client) {
+		c.provider = p
+		c.failover, c.race = nil, nil
+	}
+}
+
+// lookupFailover runs lookup on the primary provider and then on the
+// failover providers until one of them answers.
+func (c *Client) lookupFailover(ctx context.Context, name, queryType string) (dohResponse, Provider, error) {
+	res, err := c.lookup(ctx, name, queryType)
+	if err == nil || len(c.fallbacks) == 0 {
+		return res, c.provider, err
+	}
+
+	errs := []error{fmt.Errorf("%s: %w", c.provider.URL, err)}
+	for _, fc := range c.fallbacks {
+		if ctx.Err() != nil {
+			break
+		}
+		res, err := fc.lookup(ctx, name, queryType)
+		if err == nil {
+			return res, fc.provider, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", fc.provider.URL, err))
+	}
+	return dohResponse{}, Provider{}, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
+
+// lookup runs lookupOnce and retries retryable errors. Every attempt is
+// timed on its own, and only the timing of the attempt that answered is
+// kept.
+func (c *Client) lookup(ctx context.Context, name, queryType string) (dohResponse, error) {
+	rec := timingFrom(ctx)
+	for attempt := 0; ; attempt++ {
+		attemptCtx := ctx
+		var attemptRec *timingRecorder
+		if rec != nil {
+			attemptCtx, attemptRec = withTiming(ctx)
+		}
+		res, err := c.lookupOnce(attemptCtx, name, queryType)
+		if err == nil && rec != nil {
+			rec.keep(attemptRec)
+		}
+		if err == nil || attempt >= c.retries || ctx.Err() != nil || !retryable(err) {
+			return res, err
+		}
+
+		timer := time.NewTimer(retryDelay(c.retryBackoff, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return res, err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a failed query may succeed when repeated.
+func retryable(err error) bool {
+	var statusErr HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryDelay returns the exponential backoff before retry attempt+1 with
+// jitter: a random duration between half and all of backoff*2^attempt.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	d := backoff << min(attempt, 16)
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d/2)
+}
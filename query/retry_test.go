@@ -0,0 +1,129 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer answers JSON queries after failing the first failures
+// requests with status.
+func flakyServer(t *testing.T, status, failures int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-json")
+		_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":300,"data":"192.0.2.1"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestClientRetries(t *testing.T) {
+	srv, requests := flakyServer(t, http.StatusServiceUnavailable, 2)
+	client := NewClient(WithProviderURL(srv.URL), WithRetries(2, time.Millisecond))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests.Load() != 3 || len(output.Records) != 1 || output.Provider != "" {
+		t.Fatalf("unexpected output after %d requests: %+v", requests.Load(), output)
+	}
+
+	srv, requests = flakyServer(t, http.StatusTooManyRequests, 2)
+	client = NewClient(WithProviderURL(srv.URL), WithRetries(1, time.Millisecond))
+	_, err = client.Query(context.Background(), "example.com", "A")
+	var statusErr HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests || requests.Load() != 2 {
+		t.Fatalf("unexpected error after %d requests: %v", requests.Load(), err)
+	}
+}
+
+func TestClientRetriesTiming(t *testing.T) {
+	srv, _ := flakyServer(t, http.StatusServiceUnavailable, 1)
+	client := NewClient(WithProviderURL(srv.URL), WithRetries(1, time.Millisecond), WithVerbose(true))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The retry reuses the connection of the failed attempt, whose connect
+	// time must not show up in the timing of the answer.
+	if timing := output.Timing; !timing.Reused || timing.Connect != 0 || timing.Headers["X-Content-Type-Options"] != "" {
+		t.Fatalf("unexpected timing: %+v", timing)
+	}
+}
+
+func TestClientRetriesNotRetryable(t *testing.T) {
+	srv, requests := flakyServer(t, http.StatusBadRequest, 1)
+	client := NewClient(WithProviderURL(srv.URL), WithRetries(3, time.Millisecond))
+	if _, err := client.Query(context.Background(), "example.com", "A"); err == nil {
+		t.Fatal("expected error")
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("got %d requests, want 1", requests.Load())
+	}
+}
+
+func TestClientFailover(t *testing.T) {
+	down, downRequests := flakyServer(t, http.StatusInternalServerError, 100)
+	up, _ := flakyServer(t, http.StatusInternalServerError, 0)
+
+	client := NewClient(WithProviderURL(down.URL), WithRetries(1, time.Millisecond),
+		WithFailover(Provider{URL: down.URL, Protocol: ProtocolJSON}, Provider{URL: up.URL, Protocol: ProtocolJSON}))
+	defer func() {
+		_ = client.Close()
+	}()
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.Provider != up.URL || downRequests.Load() != 4 {
+		t.Fatalf("unexpected provider %q after %d failed requests", output.Provider, downRequests.Load())
+	}
+
+	client = NewClient(WithProviderURL(down.URL), WithFailover(Provider{URL: down.URL, Protocol: ProtocolJSON}))
+	_, err = client.Query(context.Background(), "example.com", "A")
+	var statusErr HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempt := range 4 {
+		base := 100 * time.Millisecond << attempt
+		for range 20 {
+			if d := retryDelay(100*time.Millisecond, attempt); d < base/2 || d >= base {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v)", attempt, d, base/2, base)
+			}
+		}
+	}
+}
+
+func TestBenchIgnoresFailover(t *testing.T) {
+	down, _ := flakyServer(t, http.StatusServiceUnavailable, 100)
+	up, requests := flakyServer(t, http.StatusServiceUnavailable, 0)
+
+	b := &Benchmark{
+		Providers: []string{down.URL},
+		Names:     []string{"example.com"},
+		Types:     []string{"A"},
+		Count:     3,
+		Options:   []Option{WithFailover(Provider{URL: up.URL, Protocol: ProtocolJSON})},
+	}
+	results, err := b.Run(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Errors != 3 || requests.Load() != 0 {
+		t.Fatalf("failures of %s were answered by the failover provider: %+v", down.URL, results[0])
+	}
+}
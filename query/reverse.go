@@ -0,0 +1,150 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// FCrDNSResult reports whether a PTR hostname resolves back to the address
+// it was looked up for (forward-confirmed reverse DNS).
+type FCrDNSResult struct {
+	Hostname  string   `json:"hostname"`
+	Addresses []string `json:"addresses,omitempty"`
+	Confirmed bool     `json:"confirmed"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// parseReverseAddr parses an IPv4 or IPv6 address for a reverse lookup.
+// IPv4-mapped IPv6 addresses are treated as IPv4.
+func parseReverseAddr(ip string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid IP address: %s", ip)
+	}
+	return addr.WithZone("").Unmap(), nil
+}
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name used to look up the
+// PTR record for ip.
+func ReverseName(ip string) (string, error) {
+	addr, err := parseReverseAddr(ip)
+	if err != nil {
+		return "", err
+	}
+	return reverseName(addr), nil
+}
+
+func reverseName(addr netip.Addr) string {
+	if addr.Is4() {
+		b := addr.As4()
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", b[3], b[2], b[1], b[0])
+	}
+
+	b := addr.As16()
+	var sb strings.Builder
+	for i := len(b) - 1; i >= 0; i-- {
+		sb.WriteString(strconv.FormatUint(uint64(b[i]&0x0f), 16))
+		sb.WriteByte('.')
+		sb.WriteString(strconv.FormatUint(uint64(b[i]>>4), 16))
+		sb.WriteByte('.')
+	}
+	sb.WriteString("ip6.arpa.")
+	return sb.String()
+}
+
+// ForwardConfirm resolves every PTR hostname in records and reports whether
+// its A or AAAA records contain addr.
+func (c *Client) ForwardConfirm(ctx context.Context, addr netip.Addr, records []DNSRecord) []FCrDNSResult {
+	queryType := "A"
+	if addr.Is6() {
+		queryType = "AAAA"
+	}
+
+	var hostnames []string
+	for _, r := range records {
+		if r.Type == 12 && !slices.Contains(hostnames, r.Data) {
+			hostnames = append(hostnames, r.Data)
+		}
+	}
+	queries := make([]BatchQuery, len(hostnames))
+	for i, host := range hostnames {
+		queries[i] = BatchQuery{Type: queryType, Name: host}
+	}
+
+	results := make([]FCrDNSResult, 0, len(queries))
+	_ = c.Batch(ctx, queries, len(queries), true, func(res BatchResult) error {
+		result := FCrDNSResult{Hostname: res.Query.Name}
+		if res.Err != nil {
+			result.Error = res.Err.Error()
+		} else {
+			for _, r := range res.Output.Records {
+				if r.TypeName != queryType {
+					continue
+				}
+				result.Addresses = append(result.Addresses, r.Data)
+				if forward, err := netip.ParseAddr(r.Data); err == nil && forward.Unmap() == addr {
+					result.Confirmed = true
+				}
+			}
+		}
+		results = append(results, result)
+		return nil
+	})
+	return results
+}
+
+// DoReverse looks up the PTR records for ip and prints them like DoFormat. With
+// confirm set, each returned hostname is resolved forward and checked
+// against ip.
+func DoReverse(ip string, enableWhois bool, format string, confirm bool, provider string, opts ...Option) error {
+	formatter, err := GetFormatter(format)
+	if err != nil {
+		return err
+	}
+	return DoReverseFormatter(ip, enableWhois, formatter, confirm, provider, opts...)
+}
+
+// DoReverseFormatter is like DoReverse but prints the response with
+// formatter.
+func DoReverseFormatter(ip string, enableWhois bool, formatter Formatter, confirm bool, provider string, opts ...Option) error {
+	addr, err := parseReverseAddr(ip)
+	if err != nil {
+		return err
+	}
+	p, err := LookupProvider(provider)
+	if err != nil {
+		return err
+	}
+
+	client := NewClient(append([]Option{WithProvider(p), WithWhois(enableWhois)}, opts...)...)
+	defer func() {
+		_ = client.Close()
+	}()
+	output, err := client.Query(context.Background(), reverseName(addr), "PTR")
+	if err != nil {
+		return err
+	}
+	if confirm {
+		output.FCrDNS = client.ForwardConfirm(context.Background(), addr, output.Records)
+	}
+
+	return formatter([]QueryOutput{{JSONOutput: *output}})
+}
+
+// fcrdnsStatus renders a forward-confirmation result for text output.
+func fcrdnsStatus(r FCrDNSResult) string {
+	switch {
+	case r.Error != "":
+		return "error: " + r.Error
+	case r.Confirmed:
+		return "confirmed"
+	case len(r.Addresses) == 0:
+		return "not confirmed (no addresses)"
+	default:
+		return "not confirmed (resolves to " + strings.Join(r.Addresses, ", ") + ")"
+	}
+}
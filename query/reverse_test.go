@@ -0,0 +1,88 @@
+package query
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "192.0.2.10", want: "10.2.0.192.in-addr.arpa."},
+		{ip: "::ffff:192.0.2.10", want: "10.2.0.192.in-addr.arpa."},
+		{ip: "2001:db8::567:89ab", want: "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+		{ip: "fe80::1%eth0", want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.e.f.ip6.arpa."},
+	}
+	for _, tt := range tests {
+		got, err := ReverseName(tt.ip)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", tt.ip, err)
+		}
+		if got != tt.want {
+			t.Fatalf("unexpected reverse name for %s; got %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	for _, ip := range []string{"example.com", "192.0.2", "192.0.2.256", ""} {
+		if _, err := ReverseName(ip); err == nil || !strings.Contains(err.Error(), "invalid IP address") {
+			t.Fatalf("expected invalid address error for %q, got %v", ip, err)
+		}
+	}
+}
+
+func TestDoReverseWithForwardConfirmation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch q.Get("name") + " " + q.Get("type") {
+		case "10.2.0.192.in-addr.arpa. PTR":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[
+				{"name":"10.2.0.192.in-addr.arpa.","type":12,"TTL":60,"data":"good.example.com."},
+				{"name":"10.2.0.192.in-addr.arpa.","type":12,"TTL":60,"data":"stale.example.com."}
+			]}`))
+		case "good.example.com. A":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"good.example.com.","type":1,"TTL":60,"data":"192.0.2.10"}]}`))
+		case "stale.example.com. A":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"stale.example.com.","type":1,"TTL":60,"data":"198.51.100.7"}]}`))
+		default:
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	out := captureStdout(t, func() {
+		if err := DoReverse("192.0.2.10", false, FormatJSON, true, DefaultProvider, WithProviderURL(srv.URL)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+
+	var got JSONOutput
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("expected valid json, got %q: %v", out, err)
+	}
+	if len(got.Records) != 2 || len(got.FCrDNS) != 2 {
+		t.Fatalf("unexpected output: %+v", got)
+	}
+	if !got.FCrDNS[0].Confirmed || got.FCrDNS[0].Hostname != "good.example.com." {
+		t.Fatalf("expected good.example.com. to be confirmed: %+v", got.FCrDNS[0])
+	}
+	if got.FCrDNS[1].Confirmed || got.FCrDNS[1].Addresses[0] != "198.51.100.7" {
+		t.Fatalf("expected stale.example.com. not to be confirmed: %+v", got.FCrDNS[1])
+	}
+
+	text := captureStdout(t, func() {
+		if err := DoReverse("192.0.2.10", false, FormatText, true, DefaultProvider, WithProviderURL(srv.URL)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	for _, want := range []string{"fcrdns: good.example.com. confirmed", "fcrdns: stale.example.com. not confirmed (resolves to 198.51.100.7)"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("text output missing %q: %s", want, text)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// FormatTemplate is the format name reported for a --template formatter.
+const FormatTemplate = "template"
+
+// templateFuncs are the helper functions available to output templates.
+var templateFuncs = template.FuncMap{
+	"typeName": dnsTypeName,
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"ttlHuman": ttlHuman,
+}
+
+// NewTemplateFormatter returns a formatter that executes a Go text/template
+// for every response. The template receives a QueryOutput, so JSONOutput
+// fields such as .Records are available directly, along with .QueryType and
+// .QueryName for multi-type queries. Like GetFormatter, the formatter prints
+// the Timing of verbose queries to stderr. Pass it to DoFormatter; it is not
+// registered as a named format.
+func NewTemplateFormatter(text string) (Formatter, error) {
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("template parse error: %w", err)
+	}
+	return printingTiming(func(outputs []QueryOutput) error {
+		for _, out := range outputs {
+			if err := tmpl.Execute(os.Stdout, out); err != nil {
+				return fmt.Errorf("template execute error: %w", err)
+			}
+		}
+		return nil
+	}), nil
+}
+
+// ttlHuman renders a TTL in seconds as a compact duration such as "1d2h".
+func ttlHuman(ttl int) string {
+	if ttl <= 0 {
+		return "0s"
+	}
+	var b strings.Builder
+	for _, unit := range []struct {
+		suffix  string
+		seconds int
+	}{
+		{"w", 7 * 24 * 3600},
+		{"d", 24 * 3600},
+		{"h", 3600},
+		{"m", 60},
+		{"s", 1},
+	} {
+		if n := ttl / unit.seconds; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.suffix)
+			ttl %= unit.seconds
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package query
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFormatter(t *testing.T) {
+	f, err := NewTemplateFormatter(`{{range .Records}}{{.Data}} {{.TTL}}{{"\n"}}{{end}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out := captureStdout(t, func() {
+		if err := f([]QueryOutput{{JSONOutput: formatTestOutput()}}); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	if want := "10 mail.example.com. 300\n"; out != want {
+		t.Fatalf("unexpected output; got %q, want %q", out, want)
+	}
+}
+
+func TestDoFormatterTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":300,"data":"192.0.2.1"}]}`))
+	}))
+	defer srv.Close()
+
+	f, err := NewTemplateFormatter(`{{range .Records}}{{.Data}}{{"\n"}}{{end}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := captureStdout(t, func() {
+		if err := DoFormatter("A", "example.com", false, f, DefaultProvider, WithProvider(Provider{URL: srv.URL, Protocol: ProtocolJSON})); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if out != "192.0.2.1\n" {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	if slices.Contains(Formats(), FormatTemplate) {
+		t.Fatalf("template formatter was registered: %v", Formats())
+	}
+}
+
+func TestTemplateHelpers(t *testing.T) {
+	f, err := NewTemplateFormatter(`{{.QueryType | lower}} {{typeName 65}} {{upper .StatusName | lower}} {{join ", " .Comments}} {{range .Records}}{{ttlHuman .TTL}}{{end}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	output := formatTestOutput()
+	output.Comments = []string{"one", "two"}
+	output.Records[0].TTL = 90061
+	out := captureStdout(t, func() {
+		if err := f([]QueryOutput{{QueryType: "MX", JSONOutput: output}}); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	})
+	if want := "mx HTTPS noerror one, two 1d1h1m1s"; out != want {
+		t.Fatalf("unexpected output; got %q, want %q", out, want)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	if _, err := NewTemplateFormatter(`{{.Records`); err == nil || !strings.Contains(err.Error(), "template parse error") {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+
+	f, err := NewTemplateFormatter(`{{.Missing}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = captureStdout(t, func() {
+		if err := f([]QueryOutput{{JSONOutput: formatTestOutput()}}); err == nil || !strings.Contains(err.Error(), "template execute error") {
+			t.Fatalf("unexpected execute error: %v", err)
+		}
+	})
+}
+
+func TestTTLHuman(t *testing.T) {
+	for ttl, want := range map[int]string{0: "0s", 59: "59s", 300: "5m", 3600: "1h", 86400: "1d", 604800 + 7200: "1w2h"} {
+		if got := ttlHuman(ttl); got != want {
+			t.Fatalf("ttlHuman(%d) = %q, want %q", ttl, got, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package query
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Timing breaks down where the time of a query was spent, in milliseconds.
+// The phases are only known for DNS-over-HTTPS requests; they are zero when
+// a pooled connection was reused. After retries or a failover the phases are
+// those of the request that answered, while Total covers the whole query.
+type Timing struct {
+	DNSLookup    float64 `json:"dns_ms"`
+	Connect      float64 `json:"connect_ms"`
+	TLSHandshake float64 `json:"tls_ms"`
+	FirstByte    float64 `json:"ttfb_ms"`
+	Total        float64 `json:"total_ms"`
+	// Protocol is the HTTP protocol version of the response, or the
+	// provider protocol for other transports.
+	Protocol   string            `json:"protocol"`
+	TLSVersion string            `json:"tls_version,omitempty"`
+	Reused     bool              `json:"reused_connection"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+// WithVerbose records a Timing for every query, returned in
+// JSONOutput.Timing.
+func WithVerbose(enable bool) Option {
+	return func(c *Client) {
+		c.verbose = enable
+	}
+}
+
+type timingKey struct{}
+
+// timingRecorder collects the Timing of one query through httptrace.
+type timingRecorder struct {
+	mu     sync.Mutex
+	timing Timing
+	start  time.Time
+}
+
+func withTiming(ctx context.Context) (context.Context, *timingRecorder) {
+	rec := &timingRecorder{start: time.Now()}
+	return context.WithValue(ctx, timingKey{}, rec), rec
+}
+
+func timingFrom(ctx context.Context) *timingRecorder {
+	rec, _ := ctx.Value(timingKey{}).(*timingRecorder)
+	return rec
+}
+
+// keep replaces the recorded phases with those of other, e.g. of the attempt
+// that answered. The start time, and so the total, is left unchanged.
+func (r *timingRecorder) keep(other *timingRecorder) {
+	other.mu.Lock()
+	timing := other.timing
+	other.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timing = timing
+}
+
+// trace returns ctx with a client trace that records the phases of an HTTP
+// request sent now.
+func (r *timingRecorder) trace(ctx context.Context) context.Context {
+	start := time.Now()
+	var dnsStart, connectStart, tlsStart time.Time
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timing.DNSLookup = milliseconds(time.Since(dnsStart))
+		},
+		ConnectStart: func(string, string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if connectStart.IsZero() {
+				connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err == nil && r.timing.Connect == 0 {
+				r.timing.Connect = milliseconds(time.Since(connectStart))
+			}
+		},
+		TLSHandshakeStart: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timing.TLSHandshake = milliseconds(time.Since(tlsStart))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timing.Reused = info.Reused
+		},
+		GotFirstResponseByte: func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.timing.FirstByte = milliseconds(time.Since(start))
+		},
+	})
+}
+
+// response records the protocol, TLS version and headers of resp.
+func (r *timingRecorder) response(resp *http.Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timing.Protocol = resp.Proto
+	if resp.TLS != nil {
+		r.timing.TLSVersion = tls.VersionName(resp.TLS.Version)
+	}
+	r.timing.Headers = make(map[string]string, len(resp.Header))
+	for name, values := range resp.Header {
+		r.timing.Headers[name] = strings.Join(values, ", ")
+	}
+}
+
+// finish returns the recorded Timing with the total time of the query.
+func (r *timingRecorder) finish(protocol Protocol) *Timing {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	timing := r.timing
+	timing.Total = milliseconds(time.Since(r.start))
+	if timing.Protocol == "" {
+		timing.Protocol = string(protocol)
+	}
+	return &timing
+}
+
+// printTiming writes a Timing in text form, meant for stderr.
+func printTiming(w io.Writer, t *Timing) {
+	green := color.New(color.FgGreen).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+	phase := func(name string, ms float64) {
+		_, _ = fmt.Fprintf(w, "  %s: %v\n", blue(name), green(fmt.Sprintf("%.1fms", ms)))
+	}
+
+	_, _ = fmt.Fprintln(w, blue("timing:"))
+	phase("dns", t.DNSLookup)
+	phase("connect", t.Connect)
+	phase("tls handshake", t.TLSHandshake)
+	phase("first byte", t.FirstByte)
+	phase("total", t.Total)
+	_, _ = fmt.Fprintf(w, "  %s: %v\n", blue("protocol"), green(t.Protocol))
+	if t.TLSVersion != "" {
+		_, _ = fmt.Fprintf(w, "  %s: %v\n", blue("tls version"), green(t.TLSVersion))
+	}
+	_, _ = fmt.Fprintf(w, "  %s: %v\n", blue("reused connection"), green(t.Reused))
+	if len(t.Headers) > 0 {
+		_, _ = fmt.Fprintln(w, blue("headers:"))
+		for _, name := range slices.Sorted(maps.Keys(t.Headers)) {
+			_, _ = fmt.Fprintf(w, "  %s: %v\n", blue(name), green(t.Headers[name]))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientVerboseTiming(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/dns-json")
+		w.Header().Set("Age", "12")
+		_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":300,"data":"192.0.2.1"}]}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProviderURL(srv.URL), WithHTTPClient(srv.Client()), WithVerbose(true))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	timing := output.Timing
+	if timing == nil {
+		t.Fatal("expected timing")
+	}
+	if timing.Connect <= 0 || timing.TLSHandshake <= 0 || timing.FirstByte <= 0 || timing.Total < timing.FirstByte {
+		t.Fatalf("unexpected phases: %+v", timing)
+	}
+	if timing.Protocol != "HTTP/1.1" || timing.TLSVersion != "TLS 1.3" || timing.Reused || timing.Headers["Age"] != "12" {
+		t.Fatalf("unexpected timing: %+v", timing)
+	}
+
+	output, err = client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !output.Timing.Reused || output.Timing.TLSHandshake != 0 {
+		t.Fatalf("expected a reused connection: %+v", output.Timing)
+	}
+}
+
+func TestClientTimingDisabled(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire, Method: http.MethodGet}))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.Timing != nil {
+		t.Fatalf("unexpected timing: %+v", output.Timing)
+	}
+}
+
+func TestFormatterPrintsTiming(t *testing.T) {
+	output := JSONOutput{
+		StatusName: "NOERROR",
+		Records:    []DNSRecord{{Name: "example.com.", Type: 1, TypeName: "A", TTL: 300, Data: "192.0.2.1"}},
+		Timing:     &Timing{Total: 12.5, Protocol: "HTTP/2.0"},
+	}
+	for _, format := range []string{FormatText, FormatShort, FormatDig, FormatTable, FormatCSV, FormatJSON, FormatYAML} {
+		var stdout string
+		stderr := captureStderr(t, func() {
+			stdout = captureStdout(t, func() {
+				if err := OutputResponse(output, format); err != nil {
+					t.Fatalf("%s: unexpected error: %v", format, err)
+				}
+			})
+		})
+		carried := format == FormatJSON || format == FormatYAML
+		if strings.Contains(stdout, "12.5") != carried {
+			t.Errorf("%s: unexpected stdout:\n%s", format, stdout)
+		}
+		if strings.Contains(stderr, "timing:") == carried || (!carried && !strings.Contains(stderr, "12.5ms")) {
+			t.Errorf("%s: unexpected stderr:\n%s", format, stderr)
+		}
+	}
+}
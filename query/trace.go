@@ -0,0 +1,210 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// dnameType is the DNAME record type.
+const dnameType = 39
+
+// maxTraceHops bounds the alias chain followed by a trace, in case the
+// answer section contains a loop.
+const maxTraceHops = 16
+
+// Trace is the resolution path of a query: the CNAME and DNAME records
+// followed from the queried name and, when requested, the zones delegated
+// on the way from the TLD to the name.
+type Trace struct {
+	Name string `json:"name"`
+	// Target is the name the answer records belong to after following
+	// the chain.
+	Target     string       `json:"target"`
+	Chain      []TraceHop   `json:"chain,omitempty"`
+	Delegation []Delegation `json:"delegation,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// TraceHop is a CNAME or DNAME record that redirected the query.
+type TraceHop struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+	TTL    int    `json:"ttl"`
+}
+
+// Delegation is a zone cut found while tracing, with its name servers.
+type Delegation struct {
+	Zone        string   `json:"zone"`
+	NameServers []string `json:"name_servers"`
+	TTL         int      `json:"ttl"`
+}
+
+// WithTrace attaches the CNAME/DNAME chain of the answer to every response.
+func WithTrace(enable bool) Option {
+	return func(c *Client) {
+		c.trace = enable
+	}
+}
+
+// WithTraceDelegation attaches the chain like WithTrace and also queries the
+// NS records of every ancestor of the name to show the delegation path from
+// the TLD down to the authoritative zone.
+func WithTraceDelegation(enable bool) Option {
+	return func(c *Client) {
+		c.traceDelegation = enable
+		if enable {
+			c.trace = true
+		}
+	}
+}
+
+// traceChain follows the CNAME and DNAME records of an answer section
+// starting at name.
+func traceChain(name string, records []DNSRecord) *Trace {
+	trace := &Trace{Name: fqdn(name)}
+	current := trace.Name
+	used := make([]bool, len(records))
+	for range maxTraceHops {
+		if i := dnameFor(current, records, used); i >= 0 {
+			r := records[i]
+			used[i] = true
+			trace.Chain = append(trace.Chain, TraceHop{Name: fqdn(r.Name), Type: "DNAME", Target: fqdn(r.Data), TTL: r.TTL})
+			synthesized := substituteDNAME(current, r.Name, r.Data)
+			if i := cnameFor(current, records, used); i >= 0 {
+				used[i] = true
+				synthesized = fqdn(records[i].Data)
+			}
+			current = synthesized
+			continue
+		}
+		i := cnameFor(current, records, used)
+		if i < 0 {
+			break
+		}
+		r := records[i]
+		used[i] = true
+		trace.Chain = append(trace.Chain, TraceHop{Name: fqdn(r.Name), Type: "CNAME", Target: fqdn(r.Data), TTL: r.TTL})
+		current = fqdn(r.Data)
+	}
+	trace.Target = current
+	return trace
+}
+
+func cnameFor(name string, records []DNSRecord, used []bool) int {
+	for i, r := range records {
+		if !used[i] && r.Type == cnameType && sameOwner(r.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// dnameFor finds an unused DNAME record owned by a proper ancestor of name.
+func dnameFor(name string, records []DNSRecord, used []bool) int {
+	lower := strings.ToLower(fqdn(name))
+	for i, r := range records {
+		if !used[i] && r.Type == dnameType && strings.HasSuffix(lower, "."+strings.ToLower(fqdn(r.Name))) {
+			return i
+		}
+	}
+	return -1
+}
+
+// substituteDNAME replaces the owner suffix of name with target
+// (RFC 6672 section 2.2).
+func substituteDNAME(name, owner, target string) string {
+	prefix := fqdn(name)[:len(fqdn(name))-len(fqdn(owner))]
+	if target == "." {
+		return prefix
+	}
+	return prefix + fqdn(target)
+}
+
+// delegationPath queries the NS records of every ancestor of name, from the
+// TLD down to name itself, and returns the zone cuts found.
+func (c *Client) delegationPath(ctx context.Context, name string) ([]Delegation, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn(name), "."), ".")
+	var cuts []Delegation
+	for i := len(labels) - 1; i >= 0; i-- {
+		zone := strings.Join(labels[i:], ".") + "."
+		res, err := c.lookup(ctx, zone, "NS")
+		if err != nil {
+			return cuts, fmt.Errorf("NS query for %s: %w", zone, err)
+		}
+		if res.Status == 3 {
+			break
+		}
+		if res.Status != 0 {
+			return cuts, fmt.Errorf("NS query for %s: %s", zone, formatRcodeError(res.Status))
+		}
+
+		cut := Delegation{Zone: zone}
+		alias := false
+		for _, r := range res.Answer {
+			switch {
+			case !sameOwner(r.Name, zone):
+			case r.Type == 2:
+				cut.NameServers = append(cut.NameServers, fqdn(r.Data))
+				cut.TTL = r.TTL
+			case r.Type == cnameType:
+				alias = true
+			}
+		}
+		if len(cut.NameServers) > 0 {
+			slices.Sort(cut.NameServers)
+			cuts = append(cuts, cut)
+		}
+		if alias {
+			break
+		}
+	}
+	return cuts, nil
+}
+
+// printTrace renders the trace of a response as a tree ending in the answer
+// records of the final name.
+func printTrace(output JSONOutput) {
+	green := color.New(color.FgGreen).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+	trace := output.Trace
+
+	fmt.Println(blue("trace:"))
+	fmt.Println(green(trace.Name))
+	indent := ""
+	for _, hop := range trace.Chain {
+		fmt.Printf("%s└── %s %s (ttl %d)\n", indent, blue(hop.Type), green(hop.Target), hop.TTL)
+		indent += "    "
+	}
+	var final []DNSRecord
+	for _, r := range output.Records {
+		if r.Type != cnameType && r.Type != dnameType && sameOwner(r.Name, trace.Target) {
+			final = append(final, r)
+		}
+	}
+	for i, r := range final {
+		branch := "├──"
+		if i == len(final)-1 {
+			branch = "└──"
+		}
+		fmt.Printf("%s%s %s %s (ttl %d)\n", indent, branch, blue(r.TypeName), green(r.Data), r.TTL)
+	}
+
+	if len(trace.Delegation) > 0 {
+		fmt.Println(blue("delegation:"))
+		for i, cut := range trace.Delegation {
+			prefix := ""
+			if i > 0 {
+				prefix = strings.Repeat("    ", i-1) + "└── "
+			}
+			fmt.Printf("%s%s (%s)\n", prefix, green(cut.Zone), strings.Join(cut.NameServers, ", "))
+		}
+	}
+	if trace.Error != "" {
+		fmt.Printf("%s: %v\n", blue("trace error"), trace.Error)
+	}
+}
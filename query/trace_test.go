@@ -0,0 +1,116 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTraceChain(t *testing.T) {
+	records := makeDNSRecords([]dohRecord{
+		{Name: "www.example.com.", Type: 5, TTL: 300, Data: "www.example.org."},
+		{Name: "example.org.", Type: 39, TTL: 600, Data: "example.net."},
+		{Name: "www.example.org.", Type: 5, TTL: 600, Data: "www.example.net."},
+		{Name: "www.example.net.", Type: 1, TTL: 60, Data: "192.0.2.1"},
+	}, false)
+
+	trace := traceChain("WWW.example.com", records)
+	want := []TraceHop{
+		{Name: "www.example.com.", Type: "CNAME", Target: "www.example.org.", TTL: 300},
+		{Name: "example.org.", Type: "DNAME", Target: "example.net.", TTL: 600},
+	}
+	if len(trace.Chain) != len(want) {
+		t.Fatalf("unexpected chain: %+v", trace.Chain)
+	}
+	for i := range want {
+		if trace.Chain[i] != want[i] {
+			t.Fatalf("hop %d: got %+v, want %+v", i, trace.Chain[i], want[i])
+		}
+	}
+	if trace.Target != "www.example.net." {
+		t.Fatalf("unexpected target %q", trace.Target)
+	}
+}
+
+func TestTraceChainSynthesizesDNAME(t *testing.T) {
+	records := makeDNSRecords([]dohRecord{
+		{Name: "example.org.", Type: 39, TTL: 600, Data: "example.net."},
+		{Name: "a.b.example.net.", Type: 1, TTL: 60, Data: "192.0.2.1"},
+	}, false)
+	if trace := traceChain("a.b.Example.org.", records); trace.Target != "a.b.example.net." {
+		t.Fatalf("unexpected target %q", trace.Target)
+	}
+}
+
+func TestTraceChainLoop(t *testing.T) {
+	records := makeDNSRecords([]dohRecord{
+		{Name: "a.example.", Type: 5, TTL: 60, Data: "b.example."},
+		{Name: "b.example.", Type: 5, TTL: 60, Data: "a.example."},
+	}, false)
+	if trace := traceChain("a.example", records); len(trace.Chain) != 2 {
+		t.Fatalf("unexpected chain: %+v", trace.Chain)
+	}
+}
+
+func TestClientTraceDelegation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, qtype := r.URL.Query().Get("name"), r.URL.Query().Get("type")
+		w.Header().Set("Content-Type", "application/dns-json")
+		switch {
+		case qtype == "A":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[
+				{"name":"www.example.com.","type":5,"TTL":300,"data":"cdn.example.net."},
+				{"name":"cdn.example.net.","type":1,"TTL":60,"data":"192.0.2.1"}]}`))
+		case name == "com.":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[
+				{"name":"com.","type":2,"TTL":172800,"data":"b.gtld-servers.net."},
+				{"name":"com.","type":2,"TTL":172800,"data":"a.gtld-servers.net."}]}`))
+		case name == "example.com.":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":2,"TTL":86400,"data":"ns1.example.com"}]}`))
+		case name == "www.example.com.":
+			_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"www.example.com.","type":5,"TTL":300,"data":"cdn.example.net."}]}`))
+		default:
+			t.Errorf("unexpected query %s %s", qtype, name)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProviderURL(srv.URL), WithTraceDelegation(true))
+	output, err := client.Query(context.Background(), "www.example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	trace := output.Trace
+	if trace == nil || trace.Target != "cdn.example.net." || len(trace.Chain) != 1 || trace.Error != "" {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	got := fmt.Sprint(trace.Delegation)
+	want := "[{com. [a.gtld-servers.net. b.gtld-servers.net.] 172800} {example.com. [ns1.example.com.] 86400}]"
+	if got != want {
+		t.Fatalf("got delegation %s, want %s", got, want)
+	}
+}
+
+func TestClientTraceDelegationError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/dns-json")
+		if r.URL.Query().Get("type") == "NS" {
+			_, _ = w.Write([]byte(`{"Status":2}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Status":0,"Answer":[{"name":"example.com.","type":1,"TTL":60,"data":"192.0.2.1"}]}`))
+	}))
+	defer srv.Close()
+
+	client := NewClient(WithProviderURL(srv.URL), WithTraceDelegation(true))
+	output, err := client.Query(context.Background(), "example.com", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output.Trace == nil || output.Trace.Error == "" || len(output.Records) != 1 {
+		t.Fatalf("unexpected output: %+v", output)
+	}
+}
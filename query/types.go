@@ -1,6 +1,10 @@
 package query
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 // Names from the IANA DNS Resource Record (RR) TYPE registry.
 var dnsTypeNames = map[int]string{
@@ -29,3 +33,26 @@ func dnsTypeName(recordType int) string {
 	}
 	return "TYPE" + strconv.Itoa(recordType)
 }
+
+// dnsTypeCodes maps upper-case type mnemonics back to their type numbers.
+var dnsTypeCodes = func() map[string]int {
+	codes := make(map[string]int, len(dnsTypeNames))
+	for code, name := range dnsTypeNames {
+		codes[strings.ToUpper(name)] = code
+	}
+	delete(codes, "RESERVED")
+	return codes
+}()
+
+// parseDNSType converts a type mnemonic ("a", "HTTPS"), the generic
+// "TYPEnnn" notation or a plain number into a DNS type number.
+func parseDNSType(s string) (uint16, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	if code, ok := dnsTypeCodes[upper]; ok {
+		return uint16(code), nil
+	}
+	if n, err := strconv.ParseUint(strings.TrimPrefix(upper, "TYPE"), 10, 16); err == nil {
+		return uint16(n), nil
+	}
+	return 0, fmt.Errorf("unknown query type: %s", s)
+}
@@ -0,0 +1,604 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// ValidationStatus is the outcome of DNSSEC validation (RFC 4035 section
+// 4.3).
+type ValidationStatus string
+
+const (
+	// ValidationSecure means every link from the trust anchor to the answer
+	// was verified.
+	ValidationSecure ValidationStatus = "secure"
+	// ValidationInsecure means a verified proof shows that the answer is in
+	// an unsigned zone.
+	ValidationInsecure ValidationStatus = "insecure"
+	// ValidationBogus means a signature or proof that should be present is
+	// missing or does not verify.
+	ValidationBogus ValidationStatus = "bogus"
+)
+
+// rootTrustAnchors are the DS records of the root zone key signing keys
+// published by IANA: KSK-2017 and KSK-2024.
+var rootTrustAnchors = []string{
+	"20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	"38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// ValidationLink is one step of the chain of trust: the verification of an
+// RRset, or of the proof that it does not exist.
+type ValidationLink struct {
+	Zone   string           `json:"zone"`
+	Name   string           `json:"name"`
+	Type   string           `json:"type"`
+	Status ValidationStatus `json:"status"`
+	Detail string           `json:"detail,omitempty"`
+}
+
+func (l ValidationLink) String() string {
+	s := fmt.Sprintf("%s %s %s", l.Name, l.Type, l.Status)
+	if l.Detail != "" {
+		s += ": " + l.Detail
+	}
+	return s
+}
+
+// ValidationResult reports the DNSSEC status of a name and type together
+// with the chain of trust from the root. Reason describes the failing link
+// of a bogus result.
+type ValidationResult struct {
+	Name   string           `json:"name"`
+	Type   string           `json:"type"`
+	Status ValidationStatus `json:"status"`
+	Reason string           `json:"reason,omitempty"`
+	Chain  []ValidationLink `json:"chain"`
+}
+
+// zoneTrust is the validated state of a zone's keys.
+type zoneTrust struct {
+	status ValidationStatus
+	keys   []dnskey
+}
+
+// validator walks the chain of trust for one query, caching responses and
+// zone keys.
+type validator struct {
+	client   *Client
+	now      time.Time
+	anchors  []dsRecord
+	messages map[string]dnssecMsg
+	zones    map[string]zoneTrust
+	links    []ValidationLink
+}
+
+// Validate resolves name through the provider and validates the answer
+// locally: DS and DNSKEY records are followed from the root trust anchor
+// down to the zone of the answer, and every RRSIG and NSEC/NSEC3 denial
+// proof on the way is verified. Queries are sent in wire format with the DO
+// and CD bits set, so the resolver returns signatures and does not hide
+// bogus data. An error is returned only when the chain cannot be fetched.
+func (c *Client) Validate(ctx context.Context, name, queryType string) (*ValidationResult, error) {
+	qtype, err := parseDNSType(queryType)
+	if err != nil {
+		return nil, err
+	}
+	qname, err := nameFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	anchors, err := parseTrustAnchors(rootTrustAnchors)
+	if err != nil {
+		return nil, err
+	}
+
+	dnssecClient, err := c.dnssecClient()
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{
+		client:   dnssecClient,
+		now:      time.Now(),
+		anchors:  anchors,
+		messages: make(map[string]dnssecMsg),
+		zones:    make(map[string]zoneTrust),
+	}
+	if err := v.validateAnswer(ctx, qname, qtype); err != nil {
+		return nil, err
+	}
+
+	result := &ValidationResult{
+		Name:   nameString(qname),
+		Type:   dnsTypeName(int(qtype)),
+		Status: ValidationSecure,
+		Chain:  v.links,
+	}
+	for _, l := range v.links {
+		switch l.Status {
+		case ValidationBogus:
+			if result.Status != ValidationBogus {
+				result.Status = ValidationBogus
+				result.Reason = l.String()
+			}
+		case ValidationInsecure:
+			if result.Status == ValidationSecure {
+				result.Status = ValidationInsecure
+			}
+		}
+	}
+	return result, nil
+}
+
+func parseTrustAnchors(anchors []string) ([]dsRecord, error) {
+	records := make([]dsRecord, 0, len(anchors))
+	for _, a := range anchors {
+		parsed, ok := parseRData(dsType, a).(*DSData)
+		if !ok {
+			return nil, fmt.Errorf("invalid trust anchor %q", a)
+		}
+		digest, err := hex.DecodeString(parsed.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust anchor %q: %w", a, err)
+		}
+		records = append(records, dsRecord{keyTag: parsed.KeyTag, algorithm: parsed.Algorithm,
+			digestType: parsed.DigestType, digest: digest})
+	}
+	return records, nil
+}
+
+// query fetches and caches a response, with the retries, failover and race
+// providers of the client. Responses other than NOERROR and NXDOMAIN are
+// errors.
+func (v *validator) query(ctx context.Context, name []byte, qtype uint16) (dnssecMsg, error) {
+	key := string(name) + "/" + strconv.Itoa(int(qtype))
+	if msg, ok := v.messages[key]; ok {
+		return msg, nil
+	}
+	res, _, _, err := v.client.resolve(ctx, nameString(name), dnsTypeName(int(qtype)))
+	if err != nil {
+		return dnssecMsg{}, fmt.Errorf("query %s %s: %w", nameString(name), dnsTypeName(int(qtype)), err)
+	}
+	msg, err := parseDNSSECMessage(res.wire)
+	if err != nil {
+		return dnssecMsg{}, fmt.Errorf("query %s %s: unpack error: %w", nameString(name), dnsTypeName(int(qtype)), err)
+	}
+	if msg.rcode != 0 && msg.rcode != 3 {
+		return dnssecMsg{}, fmt.Errorf("query %s %s: %s", nameString(name), dnsTypeName(int(qtype)), rcodeName(msg.rcode))
+	}
+	v.messages[key] = msg
+	return msg, nil
+}
+
+// dnssecClient returns a copy of c, including its failover and race
+// providers, that sends wire-format queries with the DO and CD bits set.
+func (c *Client) dnssecClient() (*Client, error) {
+	wire, err := c.provider.wireProvider()
+	if err != nil {
+		return nil, err
+	}
+	dc := *c
+	dc.provider = wire
+	dc.request.dnssec = true
+	dc.request.checkingDisabled = true
+	dc.fallbacks, dc.racers = nil, nil
+	for _, fc := range c.fallbacks {
+		fallback, err := fc.dnssecClient()
+		if err != nil {
+			return nil, err
+		}
+		dc.fallbacks = append(dc.fallbacks, fallback)
+	}
+	for _, rc := range c.racers {
+		racer, err := rc.dnssecClient()
+		if err != nil {
+			return nil, err
+		}
+		dc.racers = append(dc.racers, racer)
+	}
+	return &dc, nil
+}
+
+func (v *validator) addLink(zone, name []byte, rrtype uint16, status ValidationStatus, detail string) {
+	v.links = append(v.links, ValidationLink{
+		Zone:   nameString(zone),
+		Name:   nameString(name),
+		Type:   dnsTypeName(int(rrtype)),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// validateAnswer validates every RRset of the answer, following CNAME and
+// DNAME records, and the denial of existence when the final name has no
+// records of qtype.
+func (v *validator) validateAnswer(ctx context.Context, qname []byte, qtype uint16) error {
+	msg, err := v.query(ctx, qname, qtype)
+	if err != nil {
+		return err
+	}
+
+	sets := groupRRsets(msg.answer)
+	target := qname
+	answered := false
+	for _, set := range sets {
+		if set.rrtype == qtype && bytes.Equal(set.name, target) {
+			answered = true
+		}
+		if set.rrtype == cnameType && bytes.Equal(set.name, target) {
+			r := rdataReader{data: set.rrs[0].rdata}
+			if next := r.wireName(); r.err == nil {
+				target = next
+			}
+			if len(set.sigs) == 0 && synthesizedFromDNAME(sets, set.name) {
+				continue // covered by the signature of the DNAME
+			}
+		}
+		if err := v.validateRRset(ctx, set, msg); err != nil {
+			return err
+		}
+	}
+	if answered {
+		return nil
+	}
+	return v.validateDenial(ctx, msg, target, qtype)
+}
+
+// synthesizedFromDNAME reports whether the answer holds a DNAME above name,
+// in which case the CNAME for name is synthesized and unsigned
+// (RFC 6672 section 5.3.1).
+func synthesizedFromDNAME(sets []*rrset, name []byte) bool {
+	return slices.ContainsFunc(sets, func(s *rrset) bool {
+		return s.rrtype == 39 && isSubdomain(name, s.name) && !bytes.Equal(name, s.name)
+	})
+}
+
+// validateRRset verifies the signature of an answer RRset with the keys of
+// the zone that signed it.
+func (v *validator) validateRRset(ctx context.Context, set *rrset, msg dnssecMsg) error {
+	var zone []byte
+	if len(set.sigs) > 0 {
+		zone = set.sigs[0].signer
+	} else {
+		var err error
+		if zone, err = v.findZone(ctx, set.name); err != nil {
+			return err
+		}
+	}
+	if !isSubdomain(set.name, zone) {
+		v.addLink(zone, set.name, set.rrtype, ValidationBogus,
+			fmt.Sprintf("signer %s is not an ancestor of the owner name", nameString(zone)))
+		return nil
+	}
+
+	trust, err := v.zoneKeys(ctx, zone)
+	if err != nil {
+		return err
+	}
+	switch trust.status {
+	case ValidationInsecure:
+		v.addLink(zone, set.name, set.rrtype, ValidationInsecure, fmt.Sprintf("zone %s is unsigned", nameString(zone)))
+		return nil
+	case ValidationBogus:
+		v.addLink(zone, set.name, set.rrtype, ValidationBogus, fmt.Sprintf("keys of zone %s are bogus", nameString(zone)))
+		return nil
+	}
+
+	sig, key, err := verifyRRset(set, zone, trust.keys, v.now)
+	if err != nil {
+		v.addLink(zone, set.name, set.rrtype, ValidationBogus, err.Error())
+		return nil
+	}
+	detail := fmt.Sprintf("signed by %s key %d", nameString(zone), key.tag)
+	if labels := int(sig.labels); labels < labelCount(set.name) {
+		denial, err := v.denialRecords(msg, zone, trust.keys)
+		if err == nil {
+			err = denial.proveWildcard(set.name, labels)
+		}
+		if errors.Is(err, errNSEC3Iterations) {
+			v.addLink(zone, set.name, set.rrtype, ValidationInsecure, "wildcard expansion not checked: "+err.Error())
+			return nil
+		}
+		if err != nil {
+			v.addLink(zone, set.name, set.rrtype, ValidationBogus, "wildcard expansion without proof: "+err.Error())
+			return nil
+		}
+		detail += ", expanded from a wildcard"
+	}
+	v.addLink(zone, set.name, set.rrtype, ValidationSecure, detail)
+	return nil
+}
+
+// validateDenial verifies the NSEC or NSEC3 proof that name has no records
+// of qtype, or does not exist at all for NXDOMAIN responses.
+func (v *validator) validateDenial(ctx context.Context, msg dnssecMsg, name []byte, qtype uint16) error {
+	zone := denialZone(msg, name)
+	if zone == nil {
+		var err error
+		if zone, err = v.findZone(ctx, name); err != nil {
+			return err
+		}
+	}
+	trust, err := v.zoneKeys(ctx, zone)
+	if err != nil {
+		return err
+	}
+	switch trust.status {
+	case ValidationInsecure:
+		v.addLink(zone, name, qtype, ValidationInsecure, fmt.Sprintf("no records; zone %s is unsigned", nameString(zone)))
+		return nil
+	case ValidationBogus:
+		v.addLink(zone, name, qtype, ValidationBogus, fmt.Sprintf("keys of zone %s are bogus", nameString(zone)))
+		return nil
+	}
+
+	denial, err := v.denialRecords(msg, zone, trust.keys)
+	if err == nil {
+		if msg.rcode == 3 {
+			err = denial.proveNXDomain(name)
+		} else {
+			err = denial.proveNoData(name, qtype)
+		}
+	}
+	if errors.Is(err, errNSEC3Iterations) {
+		v.addLink(zone, name, qtype, ValidationInsecure, "denial of existence not checked: "+err.Error())
+		return nil
+	}
+	if err != nil {
+		v.addLink(zone, name, qtype, ValidationBogus, "denial of existence not proved: "+err.Error())
+		return nil
+	}
+	what := "no records"
+	if msg.rcode == 3 {
+		what = "name does not exist"
+	}
+	v.addLink(zone, name, qtype, ValidationSecure, fmt.Sprintf("%s, proved by %s", what, denial.kind()))
+	return nil
+}
+
+// denialZone returns the zone of a negative response: the signer of the
+// NSEC and NSEC3 records, which denialRecords verifies, or the owner of the
+// SOA record in the authority section when they are not signed. The SOA is
+// not trusted for signed responses since it may come from another zone. It
+// returns nil when neither is present.
+func denialZone(msg dnssecMsg, name []byte) []byte {
+	sets := groupRRsets(msg.authority)
+	for _, set := range sets {
+		if (set.rrtype == nsecType || set.rrtype == nsec3Type) && len(set.sigs) > 0 && isSubdomain(name, set.sigs[0].signer) {
+			return set.sigs[0].signer
+		}
+	}
+	for _, set := range sets {
+		if set.rrtype == 6 && isSubdomain(name, set.name) {
+			return set.name
+		}
+	}
+	return nil
+}
+
+// denialRecords verifies the NSEC and NSEC3 RRsets in the authority section
+// of msg with the keys of zone and decodes them. It returns
+// errNSEC3Iterations, meaning the proof is to be treated as insecure, when an
+// NSEC3 record has too many iterations to be checked.
+func (v *validator) denialRecords(msg dnssecMsg, zone []byte, keys []dnskey) (denialRecords, error) {
+	var d denialRecords
+	for _, set := range groupRRsets(msg.authority) {
+		if set.rrtype != nsecType && set.rrtype != nsec3Type {
+			continue
+		}
+		if _, _, err := verifyRRset(set, zone, keys, v.now); err != nil {
+			return denialRecords{}, fmt.Errorf("%s %s: %w", nameString(set.name), dnsTypeName(int(set.rrtype)), err)
+		}
+		for _, rr := range set.rrs {
+			if err := d.add(rr); err != nil {
+				return denialRecords{}, err
+			}
+		}
+	}
+	if len(d.nsec) == 0 && len(d.nsec3) == 0 {
+		return denialRecords{}, fmt.Errorf("no NSEC or NSEC3 records")
+	}
+	if slices.ContainsFunc(d.nsec3, func(n nsec3Record) bool { return n.iterations > maxNSEC3Iterations }) {
+		return denialRecords{}, errNSEC3Iterations
+	}
+	return d, nil
+}
+
+// findZone returns the apex of the zone holding name from the SOA record of
+// a SOA query.
+func (v *validator) findZone(ctx context.Context, name []byte) ([]byte, error) {
+	msg, err := v.query(ctx, name, 6)
+	if err != nil {
+		return nil, err
+	}
+	if findRRset(groupRRsets(msg.answer), name, 6) != nil {
+		return name, nil
+	}
+	if zone := denialZone(msg, name); zone != nil {
+		return zone, nil
+	}
+	return nil, fmt.Errorf("cannot find the zone of %s", nameString(name))
+}
+
+// zoneKeys returns the validated DNSKEYs of zone, establishing trust in
+// the parent zone first.
+func (v *validator) zoneKeys(ctx context.Context, zone []byte) (zoneTrust, error) {
+	if trust, ok := v.zones[string(zone)]; ok {
+		return trust, nil
+	}
+	var trust zoneTrust
+	var err error
+	if len(nameLabels(zone)) == 0 {
+		trust, err = v.verifyKeys(ctx, zone, v.anchors, "trust anchor")
+	} else {
+		trust, err = v.delegationKeys(ctx, zone)
+	}
+	if err != nil {
+		return zoneTrust{}, err
+	}
+	v.zones[string(zone)] = trust
+	return trust, nil
+}
+
+// delegationKeys validates the DS records of zone in its parent and then
+// the zone's DNSKEYs, or the proof that the delegation is unsigned.
+func (v *validator) delegationKeys(ctx context.Context, zone []byte) (zoneTrust, error) {
+	msg, err := v.query(ctx, zone, dsType)
+	if err != nil {
+		return zoneTrust{}, err
+	}
+	dsSet := findRRset(groupRRsets(msg.answer), zone, dsType)
+
+	var parent []byte
+	if dsSet != nil && len(dsSet.sigs) > 0 {
+		parent = dsSet.sigs[0].signer
+	} else {
+		parent = denialZone(msg, zone)
+	}
+	if parent == nil || bytes.Equal(parent, zone) || !isSubdomain(zone, parent) {
+		parent = parentName(zone)
+	}
+	parentTrust, err := v.zoneKeys(ctx, parent)
+	if err != nil {
+		return zoneTrust{}, err
+	}
+	if parentTrust.status != ValidationSecure {
+		return zoneTrust{status: parentTrust.status}, nil
+	}
+
+	if dsSet == nil {
+		denial, err := v.denialRecords(msg, parent, parentTrust.keys)
+		if err == nil {
+			err = denial.proveNoDS(zone)
+		}
+		if errors.Is(err, errNSEC3Iterations) {
+			v.addLink(parent, zone, dsType, ValidationInsecure, "absence of DS records not checked: "+err.Error())
+			return zoneTrust{status: ValidationInsecure}, nil
+		}
+		if err != nil {
+			v.addLink(parent, zone, dsType, ValidationBogus, "no DS records and no valid proof of their absence: "+err.Error())
+			return zoneTrust{status: ValidationBogus}, nil
+		}
+		v.addLink(parent, zone, dsType, ValidationInsecure, "unsigned delegation, proved by "+denial.kind())
+		return zoneTrust{status: ValidationInsecure}, nil
+	}
+
+	_, key, err := verifyRRset(dsSet, parent, parentTrust.keys, v.now)
+	if err != nil {
+		v.addLink(parent, zone, dsType, ValidationBogus, err.Error())
+		return zoneTrust{status: ValidationBogus}, nil
+	}
+	var supported []dsRecord
+	for _, rr := range dsSet.rrs {
+		if ds, err := decodeDS(rr.rdata); err == nil && ds.supported() {
+			supported = append(supported, ds)
+		}
+	}
+	if len(supported) == 0 {
+		v.addLink(parent, zone, dsType, ValidationInsecure, "no DS record with a supported algorithm")
+		return zoneTrust{status: ValidationInsecure}, nil
+	}
+	v.addLink(parent, zone, dsType, ValidationSecure,
+		fmt.Sprintf("key tags %s, signed by %s key %d", dsKeyTags(supported), nameString(parent), key.tag))
+	return v.verifyKeys(ctx, zone, supported, "DS")
+}
+
+// verifyKeys fetches the DNSKEY RRset of zone and checks that it is signed
+// by a key matching one of the trusted DS records.
+func (v *validator) verifyKeys(ctx context.Context, zone []byte, trusted []dsRecord, source string) (zoneTrust, error) {
+	msg, err := v.query(ctx, zone, dnskeyType)
+	if err != nil {
+		return zoneTrust{}, err
+	}
+	set := findRRset(groupRRsets(msg.answer), zone, dnskeyType)
+	if set == nil {
+		v.addLink(zone, zone, dnskeyType, ValidationBogus, "no DNSKEY records")
+		return zoneTrust{status: ValidationBogus}, nil
+	}
+
+	var keys, anchored []dnskey
+	for _, rr := range set.rrs {
+		key, err := decodeDNSKEY(rr.rdata)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+		if slices.ContainsFunc(trusted, func(ds dsRecord) bool { return ds.matches(zone, key) }) {
+			anchored = append(anchored, key)
+		}
+	}
+	if len(anchored) == 0 {
+		v.addLink(zone, zone, dnskeyType, ValidationBogus, "no DNSKEY matches the "+source+" records")
+		return zoneTrust{status: ValidationBogus}, nil
+	}
+	_, key, err := verifyRRset(set, zone, anchored, v.now)
+	if err != nil {
+		v.addLink(zone, zone, dnskeyType, ValidationBogus, err.Error())
+		return zoneTrust{status: ValidationBogus}, nil
+	}
+	v.addLink(zone, zone, dnskeyType, ValidationSecure,
+		fmt.Sprintf("%d keys, signed by key %d matching the %s", len(keys), key.tag, source))
+	return zoneTrust{status: ValidationSecure, keys: keys}, nil
+}
+
+func dsKeyTags(records []dsRecord) string {
+	tags := make([]string, 0, len(records))
+	for _, ds := range records {
+		if tag := strconv.Itoa(int(ds.keyTag)); !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return strings.Join(tags, ", ")
+}
+
+// OutputValidation prints a validation result as text or, with FormatJSON,
+// as JSON.
+func OutputValidation(result *ValidationResult, format string) error {
+	if format == FormatJSON {
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("json marshal error: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	green := color.New(color.FgGreen).SprintFunc()
+	blue := color.New(color.FgBlue).SprintFunc()
+	fmt.Printf("%s: %v\n", blue("name"), green(result.Name))
+	fmt.Printf("%s: %v\n", blue("type"), green(result.Type))
+	fmt.Printf("%s: %v\n", blue("status"), validationColor(result.Status)(result.Status))
+	if result.Reason != "" {
+		fmt.Printf("%s: %v\n", blue("reason"), green(result.Reason))
+	}
+	fmt.Println(blue("chain:"))
+	for _, l := range result.Chain {
+		fmt.Printf("  %s %s %s", l.Name, l.Type, validationColor(l.Status)(l.Status))
+		if l.Detail != "" {
+			fmt.Printf(": %s", l.Detail)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+func validationColor(status ValidationStatus) func(a ...interface{}) string {
+	switch status {
+	case ValidationSecure:
+		return color.New(color.FgGreen).SprintFunc()
+	case ValidationInsecure:
+		return color.New(color.FgYellow).SprintFunc()
+	}
+	return color.New(color.FgRed).SprintFunc()
+}
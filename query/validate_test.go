@@ -0,0 +1,413 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testSigner signs the records of a test zone with an ECDSA P-256 key.
+type testSigner struct {
+	zone   []byte
+	key    *ecdsa.PrivateKey
+	dnskey dnssecRR
+	tag    uint16
+}
+
+func newTestSigner(t *testing.T, zone string) *testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	pub, err := key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+	rdata := append([]byte{0x01, 0x01, dnskeyProto, algECDSAP256SHA256}, pub[1:]...)
+	parsed, err := decodeDNSKEY(rdata)
+	if err != nil {
+		t.Fatalf("failed to decode key: %v", err)
+	}
+	s := &testSigner{key: key, tag: parsed.tag}
+	s.dnskey = testRR(t, zone, dnskeyType, rdata)
+	s.zone = s.dnskey.name
+	return s
+}
+
+// ds returns the DS record of the signer's key using SHA-256.
+func (s *testSigner) ds(t *testing.T) dnssecRR {
+	digest := sha256.Sum256(append(append([]byte{}, s.zone...), s.dnskey.rdata...))
+	rdata := binary.BigEndian.AppendUint16(nil, s.tag)
+	rdata = append(rdata, algECDSAP256SHA256, 2)
+	return testRR(t, nameString(s.zone), dsType, append(rdata, digest[:]...))
+}
+
+// sign returns an RRSIG record over set, valid for an hour around now.
+func (s *testSigner) sign(t *testing.T, set ...dnssecRR) dnssecRR {
+	t.Helper()
+	now := uint32(time.Now().Unix())
+	header := binary.BigEndian.AppendUint16(nil, set[0].rrtype)
+	header = append(header, algECDSAP256SHA256, byte(labelCount(set[0].name)))
+	header = binary.BigEndian.AppendUint32(header, set[0].ttl)
+	header = binary.BigEndian.AppendUint32(header, now+3600)
+	header = binary.BigEndian.AppendUint32(header, now-3600)
+	header = binary.BigEndian.AppendUint16(header, s.tag)
+	header = append(header, s.zone...)
+
+	sig, err := decodeRRSIG(header)
+	if err != nil {
+		t.Fatalf("failed to decode RRSIG: %v", err)
+	}
+	data, err := signedData(sig, set)
+	if err != nil {
+		t.Fatalf("failed to build signed data: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	r, ss, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), ss.FillBytes(make([]byte, 32))...)
+	return dnssecRR{name: set[0].name, rrtype: rrsigType, class: 1, ttl: set[0].ttl, rdata: append(header, signature...)}
+}
+
+func testRR(t *testing.T, name string, rrtype uint16, rdata []byte) dnssecRR {
+	t.Helper()
+	wire, err := nameFromString(name)
+	if err != nil {
+		t.Fatalf("invalid name %q: %v", name, err)
+	}
+	return dnssecRR{name: wire, rrtype: rrtype, class: 1, ttl: 3600, rdata: rdata}
+}
+
+func testName(t *testing.T, name string) []byte {
+	t.Helper()
+	wire, err := nameFromString(name)
+	if err != nil {
+		t.Fatalf("invalid name %q: %v", name, err)
+	}
+	return wire
+}
+
+// testTypeBitmap encodes a type bit map for types below 256.
+func testTypeBitmap(types ...uint16) []byte {
+	bitmap := make([]byte, 32)
+	length := 0
+	for _, t := range types {
+		bitmap[t/8] |= 0x80 >> (t % 8)
+		length = max(length, int(t/8)+1)
+	}
+	return append([]byte{0, byte(length)}, bitmap[:length]...)
+}
+
+type testResponse struct {
+	rcode     int
+	answer    []dnssecRR
+	authority []dnssecRR
+}
+
+// packTestResponse encodes a response without name compression.
+func packTestResponse(t *testing.T, q dnsmessage.Message, res testResponse) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, q.ID)
+	msg = binary.BigEndian.AppendUint16(msg, 0x8000|0x0100|0x0080|0x0010|uint16(res.rcode))
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(res.answer)))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(res.authority)))
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	msg = append(msg, testName(t, q.Questions[0].Name.String())...)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(q.Questions[0].Type))
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	for _, rr := range append(res.answer, res.authority...) {
+		msg = append(msg, rr.name...)
+		msg = binary.BigEndian.AppendUint16(msg, rr.rrtype)
+		msg = binary.BigEndian.AppendUint16(msg, rr.class)
+		msg = binary.BigEndian.AppendUint32(msg, rr.ttl)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(rr.rdata)))
+		msg = append(msg, rr.rdata...)
+	}
+	return msg
+}
+
+// newSignedTestZones serves a signed root and example. zone, an unsigned
+// delegation to insecure.example. and a record with a bad signature. The
+// root key is installed as the trust anchor for the test.
+func newSignedTestZones(t *testing.T) *Client {
+	t.Helper()
+	srv := newSignedTestServer(t)
+	return NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire, Method: http.MethodGet}))
+}
+
+// newSignedTestServer serves the signed test zones over RFC 8484.
+func newSignedTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	root := newTestSigner(t, ".")
+	example := newTestSigner(t, "example.")
+
+	rootDS := root.ds(t)
+	anchors := rootTrustAnchors
+	rootTrustAnchors = []string{fmt.Sprintf("%d %d %d %X", root.tag, algECDSAP256SHA256, 2, rootDS.rdata[4:])}
+	t.Cleanup(func() { rootTrustAnchors = anchors })
+
+	exampleDS := example.ds(t)
+	soa := testRR(t, "example.", 6, append(append(testName(t, "ns.example."), testName(t, "admin.example.")...), make([]byte, 20)...))
+	apexNSEC := testRR(t, "example.", nsecType, append(testName(t, "insecure.example."), testTypeBitmap(2, 6, nsecType, rrsigType, dnskeyType)...))
+	delegationNSEC := testRR(t, "insecure.example.", nsecType, append(testName(t, "www.example."), testTypeBitmap(2, nsecType, rrsigType)...))
+	www := testRR(t, "www.example.", 1, []byte{192, 0, 2, 1})
+	bad := testRR(t, "bad.example.", 1, []byte{192, 0, 2, 66})
+	badSig := example.sign(t, testRR(t, "bad.example.", 1, []byte{192, 0, 2, 2}))
+	host := testRR(t, "host.insecure.example.", 1, []byte{198, 51, 100, 1})
+	// A parent-side NSEC at the delegation to signed.example., replayed to
+	// deny its apex records.
+	signedDelegationNSEC := testRR(t, "signed.example.", nsecType, append(testName(t, "www.example."), testTypeBitmap(2, dsType, nsecType, rrsigType)...))
+	// An NSEC3 record with more iterations than are hashed.
+	costlyNSEC3 := testRR(t, base32HexNoPad.EncodeToString(make([]byte, 20))+".example.", nsec3Type,
+		slices.Concat([]byte{nsec3SHA1, 0, 0x01, 0xF4, 0, 20}, bytes.Repeat([]byte{0xFF}, 20), testTypeBitmap(1, rrsigType)))
+	insecureSOA := testRR(t, "insecure.example.", 6, append(append(testName(t, "ns.insecure.example."), testName(t, "admin.insecure.example.")...), make([]byte, 20)...))
+
+	responses := map[string]testResponse{
+		". DNSKEY":        {answer: []dnssecRR{root.dnskey, root.sign(t, root.dnskey)}},
+		"example. DS":     {answer: []dnssecRR{exampleDS, root.sign(t, exampleDS)}},
+		"example. DNSKEY": {answer: []dnssecRR{example.dnskey, example.sign(t, example.dnskey)}},
+		"www.example. A":  {answer: []dnssecRR{www, example.sign(t, www)}},
+		"bad.example. A":  {answer: []dnssecRR{bad, badSig}},
+		"missing.example. A": {rcode: 3, authority: []dnssecRR{
+			soa, example.sign(t, soa),
+			apexNSEC, example.sign(t, apexNSEC),
+			delegationNSEC, example.sign(t, delegationNSEC),
+		}},
+		"insecure.example. DS": {authority: []dnssecRR{
+			soa, example.sign(t, soa),
+			delegationNSEC, example.sign(t, delegationNSEC),
+		}},
+		"signed.example. A": {authority: []dnssecRR{
+			soa, example.sign(t, soa),
+			signedDelegationNSEC, example.sign(t, signedDelegationNSEC),
+		}},
+		"costly.example. A": {rcode: 3, authority: []dnssecRR{
+			soa, example.sign(t, soa),
+			costlyNSEC3, example.sign(t, costlyNSEC3),
+		}},
+		"host.insecure.example. A":   {answer: []dnssecRR{host}},
+		"host.insecure.example. SOA": {authority: []dnssecRR{insecureSOA}},
+	}
+	srv := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		key := q.Questions[0].Name.String() + " " + dnsTypeName(int(q.Questions[0].Type))
+		if !q.Header.CheckingDisabled {
+			t.Errorf("expected CD bit in query for %s", key)
+		}
+		res, ok := responses[key]
+		if !ok {
+			t.Errorf("unexpected query %s", key)
+			res.rcode = 2
+		}
+		return packTestResponse(t, q, res)
+	})
+	return srv
+}
+
+func TestValidate(t *testing.T) {
+	client := newSignedTestZones(t)
+
+	tests := []struct {
+		name   string
+		status ValidationStatus
+		links  []string
+	}{
+		{"www.example", ValidationSecure, []string{". DNSKEY secure", "example. DS secure", "example. DNSKEY secure", "www.example. A secure"}},
+		{"missing.example", ValidationSecure, []string{". DNSKEY secure", "example. DS secure", "example. DNSKEY secure", "missing.example. A secure: name does not exist, proved by NSEC"}},
+		{"host.insecure.example", ValidationInsecure, []string{". DNSKEY secure", "example. DS secure", "example. DNSKEY secure", "insecure.example. DS insecure", "host.insecure.example. A insecure"}},
+		{"bad.example", ValidationBogus, []string{". DNSKEY secure", "example. DS secure", "example. DNSKEY secure", "bad.example. A bogus"}},
+		{"costly.example", ValidationInsecure, []string{". DNSKEY secure", "example. DS secure", "example. DNSKEY secure", "costly.example. A insecure: denial of existence not checked: NSEC3 iterations above 100"}},
+		{"signed.example", ValidationBogus, []string{". DNSKEY secure", "example. DS secure", "example. DNSKEY secure", "signed.example. A bogus: denial of existence not proved: type bit map describes a delegation"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := client.Validate(context.Background(), tt.name, "A")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Status != tt.status {
+				t.Fatalf("got status %s, want %s; chain %+v", result.Status, tt.status, result.Chain)
+			}
+			if len(result.Chain) != len(tt.links) {
+				t.Fatalf("unexpected chain: %+v", result.Chain)
+			}
+			for i, want := range tt.links {
+				if got := result.Chain[i].String(); !strings.HasPrefix(got, want) {
+					t.Errorf("link %d: got %q, want prefix %q", i, got, want)
+				}
+			}
+			if tt.status == ValidationBogus && !strings.HasPrefix(result.Reason, tt.links[len(tt.links)-1]) {
+				t.Errorf("unexpected reason %q", result.Reason)
+			}
+		})
+	}
+}
+
+func TestValidateJSONProvider(t *testing.T) {
+	wire := newSignedTestServer(t)
+	jsonOnly := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to the JSON endpoint: %s", r.URL)
+		http.Error(w, "json only", http.StatusBadRequest)
+	}))
+	defer jsonOnly.Close()
+
+	client := NewClient(WithProvider(Provider{URL: jsonOnly.URL, Protocol: ProtocolJSON, WireURL: wire.URL}))
+	result, err := client.Validate(context.Background(), "www.example", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != ValidationSecure {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	client = NewClient(WithProvider(Provider{URL: jsonOnly.URL, Protocol: ProtocolJSON}))
+	if _, err := client.Validate(context.Background(), "www.example", "A"); err == nil || !strings.Contains(err.Error(), "only serves the JSON API") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"cloudflare", "google"} {
+		if p, _ := GetProvider(name); p.WireURL == "" {
+			t.Errorf("built-in provider %s has no wire endpoint", name)
+		}
+	}
+}
+
+func TestValidateRetriesAndFailover(t *testing.T) {
+	signed := newSignedTestServer(t)
+	var requests atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1)%2 == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		req, _ := http.NewRequest(r.Method, signed.URL+r.URL.RequestURI(), nil)
+		req.Header = r.Header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("forward request failed: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	defer flaky.Close()
+	down, _ := flakyServer(t, http.StatusServiceUnavailable, 100)
+
+	clients := map[string]*Client{
+		"retries": NewClient(WithProvider(Provider{URL: flaky.URL, Protocol: ProtocolWire, Method: http.MethodGet}),
+			WithRetries(1, 0)),
+		"failover": NewClient(WithProvider(Provider{URL: down.URL, Protocol: ProtocolWire, Method: http.MethodGet}),
+			WithFailover(Provider{URL: signed.URL, Protocol: ProtocolWire, Method: http.MethodGet})),
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			result, err := client.Validate(context.Background(), "www.example", "A")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Status != ValidationSecure {
+				t.Fatalf("unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+func TestValidateBogusTrustAnchor(t *testing.T) {
+	client := newSignedTestZones(t)
+	rootTrustAnchors = []string{"12345 13 2 " + strings.Repeat("00", 32)}
+
+	result, err := client.Validate(context.Background(), "www.example", "A")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != ValidationBogus || !strings.Contains(result.Reason, "no DNSKEY matches the trust anchor") {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+func TestOutputValidationJSON(t *testing.T) {
+	result := &ValidationResult{Name: "example.", Type: "A", Status: ValidationBogus, Reason: "example. A bogus: no RRSIG",
+		Chain: []ValidationLink{{Zone: "example.", Name: "example.", Type: "A", Status: ValidationBogus, Detail: "no RRSIG"}}}
+	out := captureStdout(t, func() {
+		if err := OutputValidation(result, FormatJSON); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+	if !strings.Contains(out, `"status": "bogus"`) || !strings.Contains(out, `"detail": "no RRSIG"`) {
+		t.Fatalf("unexpected output: %s", out)
+	}
+}
+
+func TestVerifySignatureAlgorithms(t *testing.T) {
+	data := []byte("signed data")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	rsaSig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	rsaPub := append([]byte{3, 1, 0, 1}, rsaKey.N.Bytes()...)
+	if err := verifySignature(algRSASHA256, rsaPub, data, rsaSig); err != nil {
+		t.Fatalf("RSA signature did not verify: %v", err)
+	}
+
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	if err := verifySignature(algED25519, edPub, data, ed25519.Sign(edKey, data)); err != nil {
+		t.Fatalf("Ed25519 signature did not verify: %v", err)
+	}
+	if err := verifySignature(algED25519, edPub, []byte("other data"), ed25519.Sign(edKey, data)); err == nil {
+		t.Fatal("expected Ed25519 verification to fail for other data")
+	}
+	if err := verifySignature(3, nil, data, nil); err != errUnsupportedAlgorithm {
+		t.Fatalf("expected unsupported algorithm, got %v", err)
+	}
+}
+
+func TestNSEC3Hash(t *testing.T) {
+	// RFC 5155 appendix A
+	hash := nsec3Hash(testName(t, "example."), []byte{0xaa, 0xbb, 0xcc, 0xdd}, 12)
+	if got, want := strings.ToLower(base32HexNoPad.EncodeToString(hash)), "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestCompareNames(t *testing.T) {
+	// RFC 4034 section 6.1
+	ordered := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "*.z.example."}
+	for i := 1; i < len(ordered); i++ {
+		a, b := testName(t, ordered[i-1]), testName(t, ordered[i])
+		if compareNames(a, b) >= 0 {
+			t.Errorf("expected %s < %s", ordered[i-1], ordered[i])
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// DefaultWatchInterval is the delay between queries of a Watch when the
+// response has no TTL to go by, e.g. after an error.
+const DefaultWatchInterval = 30 * time.Second
+
+// WatchChange is a change of the response seen by Watch. The first
+// response is reported as a change from nothing.
+type WatchChange struct {
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Status  string    `json:"status,omitempty"`
+	Records []string  `json:"records"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// Watch queries name repeatedly and calls emit whenever the status, the
+// answer records or the error changes. With a zero interval the query is
+// repeated when the shortest TTL of the response expires. Records are
+// compared like in Compare, so TTL changes alone are not reported. Watch
+// runs until ctx is done or emit returns an error; cancellation of ctx is
+// not reported as an error.
+func (c *Client) Watch(ctx context.Context, name, queryType string, interval time.Duration, emit func(WatchChange) error) error {
+	var last *WatchChange
+	for {
+		change, next := c.watchQuery(ctx, name, queryType)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if interval > 0 {
+			next = interval
+		}
+
+		if last == nil || change.Status != last.Status || change.Error != last.Error || !slices.Equal(change.Records, last.Records) {
+			var previous []string
+			if last != nil {
+				previous = last.Records
+			}
+			change.Added = setDifference(change.Records, previous)
+			change.Removed = setDifference(previous, change.Records)
+			if err := emit(change); err != nil {
+				return err
+			}
+			last = &change
+		}
+
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// watchQuery runs one query of a Watch and returns the response together
+// with the delay until the shortest TTL expires.
+func (c *Client) watchQuery(ctx context.Context, name, queryType string) (WatchChange, time.Duration) {
+	change := WatchChange{Time: time.Now(), Name: name, Type: queryType, Records: []string{}}
+	output, err := c.Query(ctx, name, queryType)
+	var rcodeErr RcodeError
+	if errors.As(err, &rcodeErr) {
+		output, err = &rcodeErr.Response, nil
+	}
+	if err != nil {
+		change.Error = err.Error()
+		return change, DefaultWatchInterval
+	}
+
+	change.Status = output.StatusName
+	ttl := -1
+	for _, r := range slices.Concat(output.Records, output.Authority) {
+		if ttl < 0 || r.TTL < ttl {
+			ttl = r.TTL
+		}
+	}
+	for _, r := range output.Records {
+		if r.Type != rrsigType {
+			change.Records = append(change.Records, normalizeRecord(r))
+		}
+	}
+	slices.Sort(change.Records)
+	change.Records = slices.Compact(change.Records)
+
+	if ttl < 0 {
+		return change, DefaultWatchInterval
+	}
+	return change, time.Duration(max(ttl, 1)) * time.Second
+}
+
+// setDifference returns the elements of the sorted slice a missing from
+// the sorted slice b.
+func setDifference(a, b []string) []string {
+	var diff []string
+	for _, s := range a {
+		if _, found := slices.BinarySearch(b, s); !found {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
+
+// OutputWatchChange prints a change as a diff of the record set, or as a
+// single JSON line with FormatJSON or FormatNDJSON.
+func OutputWatchChange(change WatchChange, format string) error {
+	if format == FormatJSON || format == FormatNDJSON {
+		b, err := json.Marshal(change)
+		if err != nil {
+			return fmt.Errorf("json marshal error: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	blue := color.New(color.FgBlue).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+	state := change.Status
+	if change.Error != "" {
+		state = red("error: " + change.Error)
+	}
+	fmt.Printf("%s %s %s %s\n", blue(change.Time.Format(time.RFC3339)), change.Name, change.Type, state)
+	for _, r := range change.Removed {
+		fmt.Println(red("- " + r))
+	}
+	for _, r := range change.Added {
+		fmt.Println(green("+ " + r))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package query
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestWatch(t *testing.T) {
+	var queries atomic.Int32
+	srv := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		msg := dnsmessage.Message{Header: dnsmessage.Header{ID: q.ID}, Questions: q.Questions}
+		switch queries.Add(1) {
+		case 1, 2:
+			return answerA(t, q)
+		case 3:
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 30},
+				Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 2}},
+			}}
+		default:
+			msg.Header.RCode = dnsmessage.RCodeNameError
+		}
+		return packResponse(t, msg)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire, Method: http.MethodGet}))
+	var changes []WatchChange
+	err := client.Watch(ctx, "example.com", "A", time.Millisecond, func(change WatchChange) error {
+		changes = append(changes, change)
+		if len(changes) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []struct {
+		status         string
+		added, removed []string
+	}{
+		{"NOERROR", []string{"example.com A 192.0.2.1"}, nil},
+		{"NOERROR", []string{"example.com A 192.0.2.2"}, []string{"example.com A 192.0.2.1"}},
+		{"NXDOMAIN", nil, []string{"example.com A 192.0.2.2"}},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected changes: %+v", changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Status != w.status || !slices.Equal(c.Added, w.added) || !slices.Equal(c.Removed, w.removed) {
+			t.Fatalf("change %d: got %+v, want %+v", i, c, w)
+		}
+	}
+}
+
+func TestWatchQueryTTL(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, answerA)
+	client := NewClient(WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire, Method: http.MethodGet}))
+	change, next := client.watchQuery(context.Background(), "example.com", "A")
+	if next != 60*time.Second || len(change.Records) != 1 {
+		t.Fatalf("unexpected result %+v, next query in %v", change, next)
+	}
+}
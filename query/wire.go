@@ -0,0 +1,209 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsMessageContentType is the RFC 8484 media type for wire-format messages.
+const dnsMessageContentType = "application/dns-message"
+
+// ednsUDPSize is the EDNS(0) payload size advertised in wire-format queries.
+const ednsUDPSize = 4096
+
+// requestOptions are the per-query settings shared by all transports.
+type requestOptions struct {
+	// clientSubnet is sent as EDNS Client Subnet when valid.
+	clientSubnet netip.Prefix
+	// dnssec sets the DO bit.
+	dnssec bool
+	// checkingDisabled sets the CD bit.
+	checkingDisabled bool
+}
+
+// newWireQuery builds the wire-format query for domain and queryType with
+// the client's request options.
+func (c *Client) newWireQuery(domain, queryType string) ([]byte, error) {
+	qtype, err := parseDNSType(queryType)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := buildWireQuery(domain, qtype, c.request)
+	if err != nil {
+		return nil, fmt.Errorf("build query error: %w", err)
+	}
+	return msg, nil
+}
+
+// buildWireQuery packs a recursive query for domain and qtype into a DNS
+// message. The ID is zero as recommended by RFC 8484 to keep GET requests
+// cacheable.
+func buildWireQuery(domain string, qtype uint16, opts requestOptions) ([]byte, error) {
+	name, err := dnsmessage.NewName(fqdn(domain))
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain name %q: %w", domain, err)
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		RecursionDesired: true,
+		CheckingDisabled: opts.checkingDisabled,
+	})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{
+		Name:  name,
+		Type:  dnsmessage.Type(qtype),
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(ednsUDPSize, dnsmessage.RCodeSuccess, opts.dnssec); err != nil {
+		return nil, err
+	}
+	var options []dnsmessage.Option
+	if opts.clientSubnet.IsValid() {
+		options = append(options, clientSubnetOption(opts.clientSubnet))
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{Options: options}); err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
+
+// queryWire resolves domain using the RFC 8484 application/dns-message format.
+func (c *Client) queryWire(ctx context.Context, domain, queryType string) ([]byte, error) {
+	p := c.provider
+	msg, err := c.newWireQuery(domain, queryType)
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	switch strings.ToUpper(p.Method) {
+	case "", http.MethodGet:
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+		if err == nil {
+			params := req.URL.Query()
+			params.Set("dns", base64.RawURLEncoding.EncodeToString(msg))
+			req.URL.RawQuery = params.Encode()
+		}
+	case http.MethodPost:
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(msg))
+		if err == nil {
+			req.Header.Set("content-type", dnsMessageContentType)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported HTTP method for wire format: %s", p.Method)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("new request error: %w", err)
+	}
+
+	req.Header.Set("accept", dnsMessageContentType)
+
+	content, err := c.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// parseWireResponse decodes a wire-format DNS response into the same
+// structure the JSON API produces, so both paths share the output code.
+func parseWireResponse(msg []byte) (dohResponse, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return dohResponse{}, fmt.Errorf("unpack error: %w", err)
+	}
+	if !h.Response {
+		return dohResponse{}, fmt.Errorf("unpack error: message is not a response")
+	}
+
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return dohResponse{}, fmt.Errorf("unpack error: %w", err)
+	}
+	answers, err := p.AllAnswers()
+	if err != nil {
+		return dohResponse{}, fmt.Errorf("unpack error: %w", err)
+	}
+	authorities, err := p.AllAuthorities()
+	if err != nil {
+		return dohResponse{}, fmt.Errorf("unpack error: %w", err)
+	}
+	additionals, err := p.AllAdditionals()
+	if err != nil {
+		return dohResponse{}, fmt.Errorf("unpack error: %w", err)
+	}
+
+	rcode := h.RCode
+	res := dohResponse{
+		Tc: h.Truncated,
+		Rd: h.RecursionDesired,
+		Ra: h.RecursionAvailable,
+		Ad: h.AuthenticData,
+		Cd: h.CheckingDisabled,
+	}
+	for _, q := range questions {
+		res.Question = append(res.Question, struct {
+			Name string `json:"name"`
+			Type int    `json:"type"`
+		}{Name: q.Name.String(), Type: int(q.Type)})
+	}
+	res.Answer = makeWireRecords(answers)
+	res.Authority = makeWireRecords(authorities)
+	for _, r := range additionals {
+		if r.Header.Type == dnsmessage.TypeOPT {
+			rcode = r.Header.ExtendedRCode(h.RCode)
+			if opt, ok := r.Body.(*dnsmessage.OPTResource); ok {
+				res.EDNSClientSubnet = responseClientSubnet(opt.Options)
+			}
+			continue
+		}
+		res.Additional = append(res.Additional, makeWireRecord(r))
+	}
+	res.Status = int(rcode)
+	return res, nil
+}
+
+func makeWireRecords(resources []dnsmessage.Resource) []dohRecord {
+	if len(resources) == 0 {
+		return nil
+	}
+	records := make([]dohRecord, 0, len(resources))
+	for _, r := range resources {
+		records = append(records, makeWireRecord(r))
+	}
+	return records
+}
+
+func makeWireRecord(r dnsmessage.Resource) dohRecord {
+	return dohRecord{
+		Name: r.Header.Name.String(),
+		Type: int(r.Header.Type),
+		TTL:  int(r.Header.TTL),
+		Data: formatRData(r.Body),
+	}
+}
+
+// fqdn returns domain with a trailing dot.
+func fqdn(domain string) string {
+	if strings.HasSuffix(domain, ".") {
+		return domain
+	}
+	return domain + "."
+}
@@ -0,0 +1,248 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newWireServer starts a DoH server that answers every query with the
+// response produced by answer. The decoded query is passed to answer.
+func newWireServer(t *testing.T, method string, answer func(t *testing.T, q dnsmessage.Message) []byte) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(wireHandler(t, method, answer))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// wireHandler serves RFC 8484 requests sent with method.
+func wireHandler(t *testing.T, method string, answer func(t *testing.T, q dnsmessage.Message) []byte) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			t.Errorf("unexpected method; got %s, want %s", r.Method, method)
+		}
+		if got, want := r.Header.Get("Accept"), "application/dns-message"; got != want {
+			t.Errorf("unexpected Accept header; got %q, want %q", got, want)
+		}
+
+		var raw []byte
+		var err error
+		if r.Method == http.MethodGet {
+			raw, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		} else {
+			if got, want := r.Header.Get("Content-Type"), "application/dns-message"; got != want {
+				t.Errorf("unexpected Content-Type header; got %q, want %q", got, want)
+			}
+			raw, err = io.ReadAll(r.Body)
+		}
+		if err != nil {
+			t.Errorf("failed to read query: %v", err)
+			return
+		}
+
+		var q dnsmessage.Message
+		if err := q.Unpack(raw); err != nil {
+			t.Errorf("failed to unpack query: %v", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(answer(t, q))
+	}
+}
+
+func mustName(t *testing.T, name string) dnsmessage.Name {
+	t.Helper()
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		t.Fatalf("invalid name %q: %v", name, err)
+	}
+	return n
+}
+
+func packResponse(t *testing.T, msg dnsmessage.Message) []byte {
+	t.Helper()
+	msg.Response = true
+	raw, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("failed to pack response: %v", err)
+	}
+	return raw
+}
+
+func TestBuildWireQuery(t *testing.T) {
+	raw, err := buildWireQuery("example.com", 65, requestOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(raw); err != nil {
+		t.Fatalf("failed to unpack query: %v", err)
+	}
+	if msg.ID != 0 || !msg.RecursionDesired {
+		t.Fatalf("unexpected header: %+v", msg.Header)
+	}
+	if len(msg.Questions) != 1 || msg.Questions[0].Name.String() != "example.com." || msg.Questions[0].Type != dnsmessage.TypeHTTPS {
+		t.Fatalf("unexpected question: %+v", msg.Questions)
+	}
+	if len(msg.Additionals) != 1 || msg.Additionals[0].Header.Type != dnsmessage.TypeOPT {
+		t.Fatalf("expected an EDNS(0) OPT record, got %+v", msg.Additionals)
+	}
+}
+
+func TestDoWireFormat(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		t.Run(method, func(t *testing.T) {
+			srv := newWireServer(t, method, func(t *testing.T, q dnsmessage.Message) []byte {
+				if got := q.Questions[0].Type; got != dnsmessage.TypeMX {
+					t.Errorf("unexpected query type: %v", got)
+				}
+				name := q.Questions[0].Name
+				return packResponse(t, dnsmessage.Message{
+					Header:    dnsmessage.Header{RecursionDesired: true, RecursionAvailable: true, AuthenticData: true},
+					Questions: q.Questions,
+					Answers: []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{Name: name, Class: dnsmessage.ClassINET, TTL: 300},
+						Body:   &dnsmessage.MXResource{Pref: 10, MX: mustName(t, "mail.example.com.")},
+					}},
+					Additionals: []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{Name: mustName(t, "mail.example.com."), Class: dnsmessage.ClassINET, TTL: 300},
+						Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}},
+					}},
+				})
+			})
+
+			provider := WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire, Method: method})
+			out := captureStdout(t, func() {
+				if err := Do("mx", "example.com", false, true, DefaultProvider, provider); err != nil {
+					t.Fatalf("expected nil error, got %v", err)
+				}
+			})
+
+			var got JSONOutput
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatalf("expected valid json, got %q: %v", out, err)
+			}
+			if !got.Flags.RecursionAvailable || !got.Flags.AuthenticData {
+				t.Fatalf("unexpected flags: %+v", got.Flags)
+			}
+			if len(got.Question) != 1 || got.Question[0].Name != "example.com." || got.Question[0].TypeName != "MX" {
+				t.Fatalf("unexpected question section: %+v", got.Question)
+			}
+			if len(got.Records) != 1 || got.Records[0].Data != "10 mail.example.com." || got.Records[0].TTL != 300 {
+				t.Fatalf("unexpected answer section: %+v", got.Records)
+			}
+			if len(got.Additional) != 1 || got.Additional[0].Data != "192.0.2.10" {
+				t.Fatalf("unexpected additional section: %+v", got.Additional)
+			}
+		})
+	}
+}
+
+func TestDoWireFormatRcodeError(t *testing.T) {
+	srv := newWireServer(t, http.MethodGet, func(t *testing.T, q dnsmessage.Message) []byte {
+		return packResponse(t, dnsmessage.Message{
+			Header:    dnsmessage.Header{RCode: dnsmessage.RCodeNameError},
+			Questions: q.Questions,
+		})
+	})
+
+	provider := WithProvider(Provider{URL: srv.URL, Protocol: ProtocolWire})
+	err := Do("a", "missing.example.com", false, false, DefaultProvider, provider)
+	rcodeErr, ok := err.(RcodeError)
+	if !ok {
+		t.Fatalf("expected RcodeError, got %v", err)
+	}
+	if rcodeErr.Code != 3 || rcodeErr.Response.StatusName != "NXDOMAIN" {
+		t.Fatalf("unexpected rcode error: %+v", rcodeErr)
+	}
+}
+
+func TestDoWireFormatRejectsUnknownType(t *testing.T) {
+	provider := WithProvider(Provider{URL: "http://127.0.0.1:0", Protocol: ProtocolWire})
+	err := Do("bogus", "example.com", false, false, DefaultProvider, provider)
+	if err == nil || !strings.Contains(err.Error(), "unknown query type: bogus") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseWireResponseRejectsQuery(t *testing.T) {
+	raw, err := buildWireQuery("example.com", 1, requestOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := parseWireResponse(raw); err == nil || !strings.Contains(err.Error(), "not a response") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseDNSType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint16
+	}{
+		{in: "a", want: 1},
+		{in: "HTTPS", want: 65},
+		{in: "nsap-ptr", want: 23},
+		{in: "TYPE65400", want: 65400},
+		{in: "15", want: 15},
+	}
+	for _, tt := range tests {
+		got, err := parseDNSType(tt.in)
+		if err != nil || got != tt.want {
+			t.Fatalf("parseDNSType(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseDNSType("reserved"); err == nil {
+		t.Fatal("expected error for reserved type name")
+	}
+}
+
+func TestFormatRData(t *testing.T) {
+	mustHex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatalf("invalid hex %q: %v", s, err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name string
+		body dnsmessage.ResourceBody
+		want string
+	}{
+		{name: "AAAA", body: &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}, want: "2001:db8::1"},
+		{name: "SOA", body: &dnsmessage.SOAResource{NS: mustName(t, "ns.example.com."), MBox: mustName(t, "hostmaster.example.com."), Serial: 1, Refresh: 2, Retry: 3, Expire: 4, MinTTL: 5}, want: "ns.example.com. hostmaster.example.com. 1 2 3 4 5"},
+		{name: "TXT", body: &dnsmessage.TXTResource{TXT: []string{`v=spf1 "quoted"`, "two"}}, want: `"v=spf1 \"quoted\"" "two"`},
+		{name: "SRV", body: &dnsmessage.SRVResource{Priority: 1, Weight: 2, Port: 443, Target: mustName(t, "svc.example.com.")}, want: "1 2 443 svc.example.com."},
+		{name: "HTTPS", body: &dnsmessage.HTTPSResource{SVCBResource: dnsmessage.SVCBResource{
+			Priority: 1, Target: mustName(t, "."),
+			Params: []dnsmessage.SVCParam{
+				{Key: dnsmessage.SVCParamALPN, Value: []byte("\x02h3\x02h2")},
+				{Key: dnsmessage.SVCParamIPv4Hint, Value: []byte{192, 0, 2, 1, 192, 0, 2, 2}},
+			},
+		}}, want: "1 . alpn=h3,h2 ipv4hint=192.0.2.1,192.0.2.2"},
+		{name: "CAA", body: &dnsmessage.UnknownResource{Type: 257, Data: append([]byte{0, 5}, "issueletsencrypt.org"...)}, want: `0 issue "letsencrypt.org"`},
+		{name: "DS", body: &dnsmessage.UnknownResource{Type: 43, Data: mustHex("4f660802e2d3c916f6deeac73294e8268fb5885044a833fc5459588f4a9184cfc41a5766")}, want: "20326 8 2 E2D3C916F6DEEAC73294E8268FB5885044A833FC5459588F4A9184CFC41A5766"},
+		{name: "NSEC", body: &dnsmessage.UnknownResource{Type: 47, Data: append([]byte("\x04host\x07example\x03com\x00"), 0x00, 0x06, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03)}, want: "host.example.com. A MX RRSIG NSEC"},
+		{name: "TLSA", body: &dnsmessage.UnknownResource{Type: 52, Data: mustHex("030101abcd")}, want: "3 1 1 ABCD"},
+		{name: "unknown", body: &dnsmessage.UnknownResource{Type: 65400, Data: []byte{0xde, 0xad}}, want: `\# 2 DEAD`},
+		{name: "truncated", body: &dnsmessage.UnknownResource{Type: 43, Data: []byte{0x01}}, want: `\# 1 01`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatRData(tt.body); got != tt.want {
+				t.Fatalf("unexpected presentation; got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}